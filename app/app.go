@@ -1,8 +1,11 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -13,7 +16,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(router *gin.Engine, allowedOrigin string) {
+func SetupRouter(router *gin.Engine, allowedOrigin string, store Store, rateLimits *RateLimitConfiguration) {
+	// setup storage
+	setupDataStore(store)
+
 	// setup logger, recover and CORS
 	router.Use(requestLogger(log.StandardLogger()))
 	router.Use(gin.CustomRecovery(recover))
@@ -24,43 +30,105 @@ func SetupRouter(router *gin.Engine, allowedOrigin string) {
 
 	// update stats
 	router.Use(reststats.RequestCounter())
+	reststats.SetStorageCircuitStateCheck(getStorageCircuitState)
+
+	// the instance is not ready while the storage circuit is open, so the load balancer drains it
+	health.SetReadinessCheck(isStorageAvailable)
 
-	// used for testing / health checks
+	// used for testing / health checks, never limited, so the load balancer can always reach them
 	router.GET("/health", health.HandleHealthCheck)
 	router.GET("/liveness", health.HandleLivenessCheck)
 	router.GET("/readiness", health.HandleReadinessCheck)
-	router.GET("/error", handleError)
+
+	// rate limiting
+	public := router.Group("/", rateLimitByIp(rateLimits.Public))
+	signIn := router.Group("/", rateLimitByIp(rateLimits.SignIn))
+	authenticated := router.Group("/", rateLimitByUser(rateLimits.User))
+
+	public.GET("/error", handleError)
 
 	// stats
-	router.GET("/stats", reststats.HandleEndpointWithStats(reststats.HandleGetStats))
+	public.GET("/stats", reststats.HandleEndpointWithStats(reststats.HandleGetStats))
 
 	// sign-in
-	router.POST("/signin", reststats.HandleEndpointWithStats(handleSignIn))
+	signIn.POST("/signin", reststats.HandleEndpointWithStats(handleSignIn))
 
 	// do business
-	router.GET("/win/:dt", reststats.HandleEndpointWithStats(
+	authenticated.GET("/win/:dt", reststats.HandleEndpointWithStats(
 		withAuthentication(handleGetWin)))
-	router.POST("/win/:dt", reststats.HandleEndpointWithStats(
+	authenticated.POST("/win/:dt", reststats.HandleEndpointWithStats(
 		withAuthentication(handlePostWin)))
+	authenticated.PATCH("/win/:dt", reststats.HandleEndpointWithStats(
+		withAuthentication(handlePatchWin)))
+	authenticated.DELETE("/win/:dt", reststats.HandleEndpointWithStats(
+		withAuthentication(handleDeleteWin)))
+	authenticated.POST("/win/:dt/entries", reststats.HandleEndpointWithStats(
+		withAuthentication(handlePostWinEntry)))
+	authenticated.PATCH("/win/:dt/entries/:id", reststats.HandleEndpointWithStats(
+		withAuthentication(handlePatchWinEntry)))
+	authenticated.DELETE("/win/:dt/entries/:id", reststats.HandleEndpointWithStats(
+		withAuthentication(handleDeleteWinEntry)))
+	authenticated.GET("/win/:dt/history", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetWinHistory)))
+	authenticated.POST("/win/:dt/restore/:version", reststats.HandleEndpointWithStats(
+		withAuthentication(handlePostWinRestore)))
 
-	router.GET("/wins/:from/:to", reststats.HandleEndpointWithStats(
+	authenticated.GET("/wins/:from/:to", reststats.HandleEndpointWithStats(
 		withAuthentication(handleGetWins)))
-	router.GET("/windays/:from/:to", reststats.HandleEndpointWithStats(
+	authenticated.POST("/wins/batch", reststats.HandleEndpointWithStats(
+		withAuthentication(handlePostWinBatch)))
+	authenticated.GET("/windays/:from/:to", reststats.HandleEndpointWithStats(
 		withAuthentication(handleGetWinDays)))
 
-	router.GET("/priorities", reststats.HandleEndpointWithStats(
+	authenticated.GET("/priorities", reststats.HandleEndpointWithStats(
 		withAuthentication(handleGetPriorities)))
-	router.POST("/priorities", reststats.HandleEndpointWithStats(
+	authenticated.POST("/priorities", reststats.HandleEndpointWithStats(
 		withAuthentication(handlePostPriorities)))
 
-	router.GET("/winstats/:from/:to", reststats.HandleEndpointWithStats(
+	authenticated.GET("/tags", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetTags)))
+
+	authenticated.GET("/winstats/:from/:to", reststats.HandleEndpointWithStats(
 		withAuthentication(handleGetWinStats)))
 
-	router.POST("/deletealldata", reststats.HandleEndpointWithStats(
+	authenticated.GET("/search", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetSearch)))
+
+	authenticated.GET("/review/:year", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetReview)))
+
+	authenticated.GET("/streaks", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetStreaks)))
+
+	authenticated.GET("/sync", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetSync)))
+
+	authenticated.GET("/export", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetExport)))
+
+	authenticated.POST("/import", reststats.HandleEndpointWithStats(
+		withAuthentication(handlePostImport)))
+
+	authenticated.POST("/deletealldata", reststats.HandleEndpointWithStats(
 		withAuthentication(handlePostDeleteAllData)))
 
+	authenticated.GET("/deletealldata/status", reststats.HandleEndpointWithStats(
+		withAuthentication(handleGetDeleteAllDataStatus)))
+
+	authenticated.POST("/deletealldata/cancel", reststats.HandleEndpointWithStats(
+		withAuthentication(handlePostDeleteAllDataCancel)))
+
 	// handle 404
-	router.NoRoute(reststats.HandleWithStats(notFoundHandler()))
+	router.NoRoute(rateLimitByIp(rateLimits.Public), reststats.HandleWithStats(notFoundHandler()))
+}
+
+// Keeps the history of the wins and the search index in sync with the updates, hides the accounts marked for deletion
+// The deletion is checked outside the other layers, since they call the store several times per operation
+func setupDataStore(store Store) {
+	winSearchIndex = newSearchIndex(nil, searchIndexMaxUsers, searchIndexTtl)
+	accountDeletionStore = newSoftDeletionStore(newIndexingStore(newHistoryStore(store), winSearchIndex))
+	winSearchIndex.store = accountDeletionStore
+	dataStore = accountDeletionStore
 }
 
 func getCorsConfig(allowedOrigin string) cors.Config {
@@ -68,6 +136,8 @@ func getCorsConfig(allowedOrigin string) cors.Config {
 		AllowOrigins: []string{allowedOrigin},
 		AllowHeaders: []string{"*"},
 		AllowMethods: []string{"*"},
+		// make it readable for the browser clients
+		ExposeHeaders: []string{"ETag", "Retry-After"},
 	}
 }
 
@@ -83,6 +153,10 @@ func toNoContent(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func toNotModified(c *gin.Context) {
+	c.Status(http.StatusNotModified)
+}
+
 func toUnauthorized(c *gin.Context) {
 	c.JSON(http.StatusUnauthorized, gin.H{"err": "Unauthorized"})
 }
@@ -91,15 +165,54 @@ func toBadRequest(c *gin.Context, err error) {
 	c.JSON(http.StatusBadRequest, gin.H{"err": err.Error()})
 }
 
+func toConflict(c *gin.Context, errText string, data interface{}) {
+	c.JSON(http.StatusConflict, gin.H{"err": errText, "data": data})
+}
+
+func toPreconditionFailed(c *gin.Context, errText string, data interface{}) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{"err": errText, "data": data})
+}
+
 func toNotFound(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"err": "Not Found"})
 }
 
+func toGatewayTimeout(c *gin.Context, errText string) {
+	c.JSON(http.StatusGatewayTimeout, gin.H{"err": errText})
+}
+
+// tells the client when to try again
+func toServiceUnavailable(c *gin.Context, errText string, retryAfter time.Duration) {
+	retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+	if retryAfterSeconds < 1 {
+		retryAfterSeconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"err": errText})
+}
+
 func toInternalServerError(c *gin.Context, errText string) {
 	// TODO: when too many internal server errors, set liveness to false and exit
 	c.JSON(http.StatusInternalServerError, gin.H{"err": errText})
 }
 
+// storage timeouts are reported separately, so clients can tell them from the real failures
+func toStorageError(c *gin.Context, err error) {
+	if errors.Is(err, errStorageTimeout) {
+		toGatewayTimeout(c, err.Error())
+		return
+	}
+	if errors.Is(err, errDeletionPending) {
+		toConflict(c, err.Error(), nil)
+		return
+	}
+	if errors.Is(err, errStorageCircuitOpen) {
+		toServiceUnavailable(c, err.Error(), storageCircuitBreaker.getRetryAfter(time.Now()))
+		return
+	}
+	toInternalServerError(c, err.Error())
+}
+
 func recover(c *gin.Context, err interface{}) {
 	if errText, ok := err.(string); ok {
 		toInternalServerError(c, errText)
@@ -131,6 +244,14 @@ func handleError(c *gin.Context) {
 	panic("Test error")
 }
 
+// Fixed width and always in UTC, so timestamps can be compared as strings
+const TIMESTAMP_FORMAT = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Nanoseconds are needed, as the timestamp is also used as a version
 func generateTimestamp() string {
-	return time.Now().Format(time.RFC3339)
+	return formatTimestamp(time.Now())
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(TIMESTAMP_FORMAT)
 }
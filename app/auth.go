@@ -2,11 +2,14 @@ package app
 
 import (
 	"encoding/base64"
+	"fmt"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
 
+const SESSION_CONTEXT_KEY = "session"
+
 type handlerFuncWithAuth func(*gin.Context, string, string)
 
 type sessionHeaderData struct {
@@ -15,34 +18,44 @@ type sessionHeaderData struct {
 
 func withAuthentication(handler handlerFuncWithAuth) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		sessionHeader := sessionHeaderData{}
-		if err := c.ShouldBindHeader(&sessionHeader); err != nil {
+		session, err := getSession(c)
+		if err != nil {
 			log.Printf("%v", err)
 			toUnauthorized(c)
 			return
 		}
 
-		base64Session := sessionHeader.XSession
-		if base64Session == "" {
-			log.Printf("'x-session' header is empty")
-			toUnauthorized(c)
-			return
-		}
+		handler(c, session.UserId, session.Email)
+	}
+}
 
-		encryptedSession, err := base64.StdEncoding.DecodeString(base64Session)
-		if err != nil {
-			log.Printf("'x-session' is not base64 encoded string")
-			toUnauthorized(c)
-			return
-		}
+// Parses the session from 'x-session' header
+// The result is kept in the request context, so the session is only parsed once per request
+func getSession(c *gin.Context) (*sessionData, error) {
+	if session, ok := c.Get(SESSION_CONTEXT_KEY); ok {
+		return session.(*sessionData), nil
+	}
 
-		session, err := parseEncryptedSession(encryptedSession)
-		if err != nil {
-			log.Printf("%v", err)
-			toUnauthorized(c)
-			return
-		}
+	sessionHeader := sessionHeaderData{}
+	if err := c.ShouldBindHeader(&sessionHeader); err != nil {
+		return nil, err
+	}
 
-		handler(c, session.UserId, session.Email)
+	base64Session := sessionHeader.XSession
+	if base64Session == "" {
+		return nil, fmt.Errorf("'x-session' header is empty")
+	}
+
+	encryptedSession, err := base64.StdEncoding.DecodeString(base64Session)
+	if err != nil {
+		return nil, fmt.Errorf("'x-session' is not base64 encoded string")
 	}
+
+	session, err := parseEncryptedSession(encryptedSession)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(SESSION_CONTEXT_KEY, session)
+	return session, nil
 }
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU cache with expiration, entries are grouped by user, so they can be invalidated together
+type responseCache struct {
+	lock          sync.Mutex
+	maxSize       int
+	ttl           time.Duration
+	lru           *list.List // most recently used in front
+	entries       map[string]map[string]*list.Element
+	invalidations uint64
+}
+
+type cacheEntry struct {
+	userId   string
+	key      string
+	value    interface{}
+	cachedAt time.Time
+	expires  time.Time
+}
+
+func newResponseCache(maxSize int, ttl time.Duration) *responseCache {
+	return &responseCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: map[string]map[string]*list.Element{},
+	}
+}
+
+func (c *responseCache) get(userId string, key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[userId][key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	return entry.value, true
+}
+
+// Returns the token to pass to put, the value is only cached if no invalidation happened in between,
+// so the value read from the storage before the update does not make it into the cache after the update
+func (c *responseCache) getToken() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.invalidations
+}
+
+func (c *responseCache) put(userId string, key string, value interface{}, token uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if token != c.invalidations {
+		return
+	}
+
+	if element, ok := c.entries[userId][key]; ok {
+		c.remove(element)
+	}
+
+	userEntries, ok := c.entries[userId]
+	if !ok {
+		userEntries = map[string]*list.Element{}
+		c.entries[userId] = userEntries
+	}
+	now := time.Now()
+	userEntries[key] = c.lru.PushFront(&cacheEntry{
+		userId:   userId,
+		key:      key,
+		value:    value,
+		cachedAt: now,
+		expires:  now.Add(c.ttl),
+	})
+
+	for c.lru.Len() > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *responseCache) invalidate(userId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.invalidations++
+	for _, element := range c.entries[userId] {
+		c.lru.Remove(element)
+	}
+	delete(c.entries, userId)
+}
+
+// Only drops the entries of the user cached before the given time, the newer ones stay
+func (c *responseCache) invalidateCachedBefore(userId string, t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, element := range c.entries[userId] {
+		if element.Value.(*cacheEntry).cachedAt.Before(t) {
+			c.invalidations++
+			c.remove(element)
+		}
+	}
+}
+
+// expects the lock to be held by the caller
+func (c *responseCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries[entry.userId], entry.key)
+	if len(c.entries[entry.userId]) == 0 {
+		delete(c.entries, entry.userId)
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheReturnsStoredValue(t *testing.T) {
+	cache := newResponseCache(10, time.Minute)
+
+	cache.put("user", "key", "value", cache.getToken())
+	value, ok := cache.get("user", "key")
+
+	assert.True(t, ok)
+	assert.Equal(t, "value", value)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newResponseCache(2, time.Minute)
+
+	cache.put("user", "one", 1, cache.getToken())
+	cache.put("user", "two", 2, cache.getToken())
+	cache.get("user", "one")
+	cache.put("user", "three", 3, cache.getToken())
+
+	_, ok := cache.get("user", "two")
+	assert.False(t, ok)
+	_, ok = cache.get("user", "one")
+	assert.True(t, ok)
+	_, ok = cache.get("user", "three")
+	assert.True(t, ok)
+}
+
+func TestCacheEntryExpires(t *testing.T) {
+	cache := newResponseCache(10, time.Duration(0))
+
+	cache.put("user", "key", "value", cache.getToken())
+	_, ok := cache.get("user", "key")
+
+	assert.False(t, ok)
+}
+
+func TestCacheInvalidatesOnlyGivenUser(t *testing.T) {
+	cache := newResponseCache(10, time.Minute)
+	cache.put("user", "key", "value", cache.getToken())
+	cache.put("another user", "key", "value", cache.getToken())
+
+	cache.invalidate("user")
+
+	_, ok := cache.get("user", "key")
+	assert.False(t, ok)
+	_, ok = cache.get("another user", "key")
+	assert.True(t, ok)
+}
+
+func TestCacheDoesNotStoreValueReadBeforeInvalidation(t *testing.T) {
+	cache := newResponseCache(10, time.Minute)
+
+	token := cache.getToken()
+	cache.invalidate("user")
+	cache.put("user", "key", "stale value", token)
+
+	_, ok := cache.get("user", "key")
+	assert.False(t, ok)
+}
+
+func TestCacheInvalidatesEntriesCachedBefore(t *testing.T) {
+	cache := newResponseCache(10, time.Minute)
+	cache.put("user", "old", "value", cache.getToken())
+	changedAt := time.Now()
+	cache.put("user", "new", "value", cache.getToken())
+
+	cache.invalidateCachedBefore("user", changedAt)
+
+	_, ok := cache.get("user", "old")
+	assert.False(t, ok)
+	_, ok = cache.get("user", "new")
+	assert.True(t, ok)
+}
+
+func TestDataCachedBeforeDeletionIsDropped(t *testing.T) {
+	inner := NewInMemoryStore()
+	store := NewCachingStore(inner, 10, time.Minute).(*cachingStore)
+	ctx := context.Background()
+	store.cache.put("user", "wins#20211001#20211031", []winOnDayData{{Date: "20211001"}}, store.cache.getToken())
+	store.cache.put("another user", "wins#20211001#20211031", []winOnDayData{{Date: "20211001"}}, store.cache.getToken())
+
+	// completed through another instance
+	completedAt := generateTimestamp()
+	inner.saveDeletionRequest(ctx, "user", deletionRequestData{
+		RequestedAt: completedAt,
+		Job:         deletionJobData{Status: DELETION_STATUS_COMPLETED, CompletedAt: completedAt},
+	}, nil)
+	store.getDeletionRequest(ctx, "user")
+	store.getDeletionRequest(ctx, "another user")
+
+	_, ok := store.cache.get("user", "wins#20211001#20211031")
+	assert.False(t, ok)
+	_, ok = store.cache.get("another user", "wins#20211001#20211031")
+	assert.True(t, ok)
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"artemkv.net/winaday/reststats"
+)
+
+// Caches the results of the read operations, any update invalidates everything cached for the user
+// Cached values are shared, so handlers should never modify them
+type cachingStore struct {
+	Store
+	cache *responseCache
+}
+
+type cachedPriorities struct {
+	priorities *priorityListData
+	version    string
+}
+
+func NewCachingStore(store Store, maxSize int, ttl time.Duration) Store {
+	return &cachingStore{
+		Store: store,
+		cache: newResponseCache(maxSize, ttl),
+	}
+}
+
+func (s *cachingStore) getWins(ctx context.Context, userId string, from string, to string) ([]winOnDayData, error) {
+	key := fmt.Sprintf("wins#%s#%s", from, to)
+	if cached, ok := s.lookup(userId, key); ok {
+		return cached.([]winOnDayData), nil
+	}
+
+	token := s.cache.getToken()
+	wins, err := s.Store.getWins(ctx, userId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(userId, key, wins, token)
+
+	return wins, nil
+}
+
+func (s *cachingStore) getWinDays(ctx context.Context, userId string, from string, to string) ([]string, error) {
+	key := fmt.Sprintf("windays#%s#%s", from, to)
+	if cached, ok := s.lookup(userId, key); ok {
+		return cached.([]string), nil
+	}
+
+	token := s.cache.getToken()
+	days, err := s.Store.getWinDays(ctx, userId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(userId, key, days, token)
+
+	return days, nil
+}
+
+func (s *cachingStore) getWinDayStats(ctx context.Context, userId string, from string, to string) ([]winOnDayShortData, error) {
+	key := fmt.Sprintf("winstats#%s#%s", from, to)
+	if cached, ok := s.lookup(userId, key); ok {
+		return cached.([]winOnDayShortData), nil
+	}
+
+	token := s.cache.getToken()
+	stats, err := s.Store.getWinDayStats(ctx, userId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(userId, key, stats, token)
+
+	return stats, nil
+}
+
+func (s *cachingStore) getPriorities(ctx context.Context, userId string) (*priorityListData, string, error) {
+	key := "priorities"
+	if cached, ok := s.lookup(userId, key); ok {
+		cachedPriorities := cached.(cachedPriorities)
+		return cachedPriorities.priorities, cachedPriorities.version, nil
+	}
+
+	token := s.cache.getToken()
+	priorities, version, err := s.Store.getPriorities(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	s.cache.put(userId, key, cachedPriorities{priorities: priorities, version: version}, token)
+
+	return priorities, version, nil
+}
+
+func (s *cachingStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	defer s.cache.invalidate(userId)
+	return s.Store.updateWin(ctx, userId, date, win, expectedVersion)
+}
+
+func (s *cachingStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	defer s.cache.invalidate(userId)
+	return s.Store.updateWins(ctx, userId, wins)
+}
+
+func (s *cachingStore) patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error) {
+	defer s.cache.invalidate(userId)
+	return s.Store.patchWin(ctx, userId, date, patch, expectedVersion)
+}
+
+func (s *cachingStore) deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error {
+	defer s.cache.invalidate(userId)
+	return s.Store.deleteWin(ctx, userId, date, expectedVersion)
+}
+
+func (s *cachingStore) updatePriorities(ctx context.Context, userId string, priorities priorityListData, updatedAt string, expectedVersion string) error {
+	defer s.cache.invalidate(userId)
+	return s.Store.updatePriorities(ctx, userId, priorities, updatedAt, expectedVersion)
+}
+
+func (s *cachingStore) deleteAllWins(ctx context.Context, userId string) error {
+	defer s.cache.invalidate(userId)
+	return s.Store.deleteAllWins(ctx, userId)
+}
+
+func (s *cachingStore) deletePriorities(ctx context.Context, userId string) error {
+	defer s.cache.invalidate(userId)
+	return s.Store.deletePriorities(ctx, userId)
+}
+
+// The deletion request is never cached, the deletion requested or cancelled through another instance takes effect right away
+// It is read before every other read, so the data cached before the deletion was requested, started or completed
+// through another instance is dropped here, the purger may have deleted it since
+func (s *cachingStore) getDeletionRequest(ctx context.Context, userId string) (*deletionRequestData, error) {
+	request, err := s.Store.getDeletionRequest(ctx, userId)
+	if err != nil || request == nil {
+		return request, err
+	}
+
+	// timestamps sort in the order they were made
+	changedAt := request.RequestedAt
+	for _, t := range []string{request.Job.StartedAt, request.Job.CompletedAt} {
+		if t > changedAt {
+			changedAt = t
+		}
+	}
+	if t, err := time.Parse(TIMESTAMP_FORMAT, changedAt); err == nil {
+		s.cache.invalidateCachedBefore(userId, t)
+	}
+
+	return request, nil
+}
+
+// Saving or deleting the deletion request invalidates the rest, since the data becomes hidden or visible again
+func (s *cachingStore) saveDeletionRequest(ctx context.Context, userId string, request deletionRequestData, expected *deletionRequestData) error {
+	defer s.cache.invalidate(userId)
+	return s.Store.saveDeletionRequest(ctx, userId, request, expected)
+}
+
+func (s *cachingStore) deleteDeletionRequest(ctx context.Context, userId string, expected *deletionRequestData) error {
+	defer s.cache.invalidate(userId)
+	return s.Store.deleteDeletionRequest(ctx, userId, expected)
+}
+
+func (s *cachingStore) lookup(userId string, key string) (interface{}, bool) {
+	cached, ok := s.cache.get(userId, key)
+	if ok {
+		reststats.CountCacheHit()
+	} else {
+		reststats.CountCacheMiss()
+	}
+	return cached, ok
+}
@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"artemkv.net/winaday/reststats"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const (
+	CIRCUIT_STATE_CLOSED    = "closed"
+	CIRCUIT_STATE_OPEN      = "open"
+	CIRCUIT_STATE_HALF_OPEN = "halfOpen"
+)
+
+var storageCircuitBreaker = newCircuitBreaker(5, time.Duration(30)*time.Second, reststats.CountStorageCircuitOpened)
+
+// Stops calling the storage after too many consecutive failures, the calls fail right away until the cooldown is over
+// After the cooldown, a single trial call is let through, its outcome closes the circuit or opens it again
+type circuitBreaker struct {
+	lock            sync.Mutex
+	threshold       int // 0 disables the breaker
+	cooldown        time.Duration
+	failures        int
+	openedAt        time.Time // zero when closed
+	trialInProgress bool
+	generation      int // changes every time the circuit opens or closes
+	onOpen          func()
+}
+
+// Identifies the allowed call, so its outcome only counts while the circuit is in the state the call was allowed in
+type circuitTicket struct {
+	generation int
+	isTrial    bool
+}
+
+// Fails the calls fast while the storage circuit is open
+// Wraps the retrying client, so the call that failed after all the retries counts as a single failure
+type circuitBreakingDynamoDbClient struct {
+	client dynamoDbClient
+}
+
+func SetStorageCircuitBreaker(threshold int, cooldown time.Duration) {
+	storageCircuitBreaker = newCircuitBreaker(threshold, cooldown, reststats.CountStorageCircuitOpened)
+}
+
+// Tells whether the storage is expected to serve the requests, false while the circuit is open
+func isStorageAvailable() bool {
+	return getStorageCircuitState() != CIRCUIT_STATE_OPEN
+}
+
+func getStorageCircuitState() string {
+	return storageCircuitBreaker.getState(time.Now())
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, onOpen func()) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onOpen:    onOpen,
+	}
+}
+
+// Returns false and how long to wait before trying again when the call should not be made
+// Every allowed call has to be followed by the call to done with the ticket returned
+func (b *circuitBreaker) allow(now time.Time) (circuitTicket, bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	ticket := circuitTicket{generation: b.generation}
+	switch b.getStateLocked(now) {
+	case CIRCUIT_STATE_OPEN:
+		return ticket, false, b.openedAt.Add(b.cooldown).Sub(now)
+	case CIRCUIT_STATE_HALF_OPEN:
+		if b.trialInProgress {
+			return ticket, false, time.Second
+		}
+		b.trialInProgress = true
+		ticket.isTrial = true
+	}
+	return ticket, true, 0
+}
+
+// Records the outcome of the allowed call
+// Only the errors telling that the storage is in trouble count as failures, the errors caused by the request itself do not
+// The calls allowed before the circuit last opened or closed are ignored, they tell nothing about the storage now
+func (b *circuitBreaker) done(ticket circuitTicket, err error, now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ticket.generation != b.generation {
+		return
+	}
+	if ticket.isTrial {
+		b.trialInProgress = false
+	}
+
+	// the cancelled call tells nothing about the storage, when it was the trial, the next call becomes the trial
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	isClosed := b.openedAt.IsZero()
+	if err == nil || !isStorageFailure(err) {
+		b.failures = 0
+		if !isClosed {
+			b.openedAt = time.Time{}
+			b.generation++
+		}
+		return
+	}
+
+	b.failures++
+	if ticket.isTrial || (isClosed && b.threshold > 0 && b.failures >= b.threshold) {
+		b.openedAt = now
+		b.generation++
+		b.onOpen()
+	}
+}
+
+// Returns how long to wait before the storage can be tried again, 0 when the circuit is not open
+func (b *circuitBreaker) getRetryAfter(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.getStateLocked(now) {
+	case CIRCUIT_STATE_OPEN:
+		return b.openedAt.Add(b.cooldown).Sub(now)
+	case CIRCUIT_STATE_HALF_OPEN:
+		if b.trialInProgress {
+			return time.Second
+		}
+	}
+	return 0
+}
+
+func (b *circuitBreaker) getState(now time.Time) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.getStateLocked(now)
+}
+
+// expects the lock to be held by the caller
+func (b *circuitBreaker) getStateLocked(now time.Time) string {
+	if b.openedAt.IsZero() {
+		return CIRCUIT_STATE_CLOSED
+	}
+	if now.Sub(b.openedAt) < b.cooldown {
+		return CIRCUIT_STATE_OPEN
+	}
+	return CIRCUIT_STATE_HALF_OPEN
+}
+
+// Timeouts and the errors worth retrying mean the storage is unavailable or overloaded
+func isStorageFailure(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || isRetryableError(err)
+}
+
+func newCircuitBreakingDynamoDbClient(client dynamoDbClient) dynamoDbClient {
+	return &circuitBreakingDynamoDbClient{
+		client: client,
+	}
+}
+
+func (c *circuitBreakingDynamoDbClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	var output *dynamodb.GetItemOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.GetItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *circuitBreakingDynamoDbClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	var output *dynamodb.PutItemOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.PutItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *circuitBreakingDynamoDbClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	var output *dynamodb.UpdateItemOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.UpdateItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *circuitBreakingDynamoDbClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	var output *dynamodb.DeleteItemOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.DeleteItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *circuitBreakingDynamoDbClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	var output *dynamodb.QueryOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.Query(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *circuitBreakingDynamoDbClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	var output *dynamodb.BatchGetItemOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.BatchGetItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *circuitBreakingDynamoDbClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	var output *dynamodb.BatchWriteItemOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.BatchWriteItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *circuitBreakingDynamoDbClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	var output *dynamodb.TransactWriteItemsOutput
+	err := withStorageCircuitBreaker(func() error {
+		var err error
+		output, err = c.client.TransactWriteItems(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func withStorageCircuitBreaker(call func() error) error {
+	breaker := storageCircuitBreaker
+	ticket, allowed, _ := breaker.allow(time.Now())
+	if !allowed {
+		return errStorageCircuitOpen
+	}
+
+	err := call()
+	breaker.done(ticket, err, time.Now())
+	return err
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCountingCircuitBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, *int) {
+	opened := 0
+	return newCircuitBreaker(threshold, cooldown, func() {
+		opened++
+	}), &opened
+}
+
+// Replaces the storage circuit breaker until the test is over
+func setupStorageCircuitBreaker(t *testing.T, breaker *circuitBreaker) {
+	previous := storageCircuitBreaker
+	storageCircuitBreaker = breaker
+	t.Cleanup(func() {
+		storageCircuitBreaker = previous
+	})
+}
+
+func failCalls(breaker *circuitBreaker, n int, now time.Time) {
+	for i := 0; i < n; i++ {
+		ticket, _, _ := breaker.allow(now)
+		breaker.done(ticket, &types.InternalServerError{}, now)
+	}
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	breaker, opened := newCountingCircuitBreaker(3, time.Minute)
+	now := time.Now()
+
+	failCalls(breaker, 2, now)
+	assert.Equal(t, CIRCUIT_STATE_CLOSED, breaker.getState(now))
+
+	failCalls(breaker, 1, now)
+	assert.Equal(t, CIRCUIT_STATE_OPEN, breaker.getState(now))
+	assert.Equal(t, 1, *opened)
+
+	_, allowed, wait := breaker.allow(now.Add(time.Duration(10) * time.Second))
+	assert.False(t, allowed)
+	assert.Equal(t, time.Duration(50)*time.Second, wait)
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	breaker, _ := newCountingCircuitBreaker(3, time.Minute)
+	now := time.Now()
+
+	failCalls(breaker, 2, now)
+	ticket, _, _ := breaker.allow(now)
+	breaker.done(ticket, nil, now)
+	failCalls(breaker, 2, now)
+
+	assert.Equal(t, CIRCUIT_STATE_CLOSED, breaker.getState(now))
+}
+
+func TestCircuitBreakerIgnoresRequestErrors(t *testing.T) {
+	breaker, _ := newCountingCircuitBreaker(1, time.Minute)
+	now := time.Now()
+
+	ticket, _, _ := breaker.allow(now)
+	breaker.done(ticket, &types.ConditionalCheckFailedException{}, now)
+	ticket, _, _ = breaker.allow(now)
+	breaker.done(ticket, context.Canceled, now)
+
+	assert.Equal(t, CIRCUIT_STATE_CLOSED, breaker.getState(now))
+}
+
+func TestCircuitBreakerLetsSingleTrialThroughAfterCooldown(t *testing.T) {
+	breaker, _ := newCountingCircuitBreaker(1, time.Minute)
+	now := time.Now()
+	failCalls(breaker, 1, now)
+
+	later := now.Add(time.Minute)
+	assert.Equal(t, CIRCUIT_STATE_HALF_OPEN, breaker.getState(later))
+	trial, allowed, _ := breaker.allow(later)
+	assert.True(t, allowed)
+	_, allowed, _ = breaker.allow(later)
+	assert.False(t, allowed)
+
+	breaker.done(trial, nil, later)
+	assert.Equal(t, CIRCUIT_STATE_CLOSED, breaker.getState(later))
+	_, allowed, _ = breaker.allow(later)
+	assert.True(t, allowed)
+}
+
+func TestCircuitBreakerFailedTrialOpensAgain(t *testing.T) {
+	breaker, opened := newCountingCircuitBreaker(3, time.Minute)
+	now := time.Now()
+	failCalls(breaker, 3, now)
+
+	later := now.Add(time.Minute)
+	failCalls(breaker, 1, later)
+
+	assert.Equal(t, CIRCUIT_STATE_OPEN, breaker.getState(later))
+	assert.Equal(t, 2, *opened)
+}
+
+func TestCircuitBreakerIgnoresCallsAllowedBeforeItOpened(t *testing.T) {
+	breaker, _ := newCountingCircuitBreaker(1, time.Minute)
+	now := time.Now()
+	slow, _, _ := breaker.allow(now)
+	failCalls(breaker, 1, now)
+
+	later := now.Add(time.Minute)
+	trial, allowed, _ := breaker.allow(later)
+	assert.True(t, allowed)
+	breaker.done(slow, nil, later)
+
+	assert.Equal(t, CIRCUIT_STATE_HALF_OPEN, breaker.getState(later))
+	_, allowed, _ = breaker.allow(later)
+	assert.False(t, allowed)
+	breaker.done(trial, nil, later)
+	assert.Equal(t, CIRCUIT_STATE_CLOSED, breaker.getState(later))
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	breaker, _ := newCountingCircuitBreaker(0, time.Minute)
+	now := time.Now()
+
+	failCalls(breaker, 100, now)
+
+	assert.Equal(t, CIRCUIT_STATE_CLOSED, breaker.getState(now))
+}
+
+func TestCircuitBreakingClientFailsFastWhenOpen(t *testing.T) {
+	breaker, _ := newCountingCircuitBreaker(2, time.Minute)
+	setupStorageCircuitBreaker(t, breaker)
+	failing := &failingDynamoDbClient{errors: []error{
+		&types.InternalServerError{},
+		&types.InternalServerError{},
+	}}
+	client := newCircuitBreakingDynamoDbClient(failing)
+
+	client.PutItem(context.Background(), &dynamodb.PutItemInput{})
+	client.PutItem(context.Background(), &dynamodb.PutItemInput{})
+	_, err := client.PutItem(context.Background(), &dynamodb.PutItemInput{})
+
+	assert.Equal(t, errStorageCircuitOpen, err)
+	assert.Equal(t, 2, failing.calls)
+	assert.False(t, isStorageAvailable())
+}
+
+func TestStorageErrorWhenCircuitIsOpen(t *testing.T) {
+	breaker, _ := newCountingCircuitBreaker(1, time.Minute)
+	setupStorageCircuitBreaker(t, breaker)
+	failCalls(breaker, 1, time.Now())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	toStorageError(c, logAndConvertError(errStorageCircuitOpen))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
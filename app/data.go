@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -13,6 +14,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	log "github.com/sirupsen/logrus"
+
+	"artemkv.net/winaday/reststats"
 )
 
 const (
@@ -24,29 +27,41 @@ const (
 )
 
 const (
-	//WIN_TABLE_NAME            string = "winaday-test"
-	WIN_TABLE_NAME            string = "winaday"
 	WIN_TABLE_KEY             string = "Key"
 	WIN_TABLE_SORT_KEY        string = "SortKey"
 	WIN_TABLE_TEXT_ATTR       string = "text"
 	WIN_TABLE_OVERALL_ATTR    string = "overall"
 	WIN_TABLE_PRIORITIES_ATTR string = "priorities"
+	WIN_TABLE_ENTRIES_ATTR    string = "entries"
+	WIN_TABLE_TAGS_ATTR       string = "tags"
 	WIN_TABLE_ITEMS_ATTR      string = "items"
 	WIN_TABLE_UPDATED_AT_ATTR string = "udpatedAt"
+
+	// wins and tombstones of the user share the change key, so the changes can be queried by the update timestamp
+	WIN_TABLE_CHANGE_KEY    string = "ChangeKey"
+	WIN_TABLE_CHANGES_INDEX string = "ChangesByUpdatedAt"
+
+	WIN_TABLE_REQUESTED_AT_ATTR string = "requestedAt"
+	WIN_TABLE_PURGE_AT_ATTR     string = "purgeAt"
+	WIN_TABLE_JOB_ATTR          string = "job"
 )
 
 const BATCH_SIZE = 25
+const BATCH_GET_SIZE = 100
 
 type winItem struct {
 	SortKey    string
 	Text       string
 	Overall    string
 	Priorities []string
+	Entries    []winEntryData
+	Tags       []string
 }
 
 type prioritiesListItem struct {
-	SortKey string
-	Items   []priorityItem
+	SortKey   string
+	Items     []priorityItem
+	UpdatedAt string `dynamodbav:"udpatedAt"`
 }
 
 type priorityItem struct {
@@ -60,14 +75,100 @@ type winRefData struct {
 	SortKey string
 }
 
-func updateWin(userId string, date string, win winData) error {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+type deletionRequestItem struct {
+	SortKey     string
+	RequestedAt string          `dynamodbav:"requestedAt"`
+	PurgeAt     string          `dynamodbav:"purgeAt"`
+	Job         deletionJobData `dynamodbav:"job"`
+}
+
+type winTimestampData struct {
+	Key       string
+	SortKey   string
+	UpdatedAt string `dynamodbav:"udpatedAt"`
+}
+
+type dynamoDbStore struct {
+	client    dynamoDbClient
+	tableName string
+}
+
+// Creates the store backed by a single DynamoDB client, shared by all requests
+// region can be empty, in which case the default AWS config resolution applies
+// endpoint can be used to point to DynamoDB Local, e.g. "http://localhost:8000"
+// The calls are retried according to the storage retry policy, the retries of the SDK itself are disabled
+// The calls fail right away while the storage circuit is open
+func NewDynamoDbStore(region string, endpoint string, tableName string) (Store, error) {
+	var options []func(*config.LoadOptions) error
+	if region != "" {
+		options = append(options, config.WithRegion(region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.EndpointResolver = dynamodb.EndpointResolverFromURL(endpoint)
+		}
+		o.Retryer = aws.NopRetryer{}
+	})
+
+	return &dynamoDbStore{
+		client:    newCircuitBreakingDynamoDbClient(newRetryingDynamoDbClient(client, reststats.CountStorageRetry)),
+		tableName: tableName,
+	}, nil
+}
+
+// The version is checked on the win read before the write, the write only succeeds if the win has not changed since
+func (s *dynamoDbStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// encode data
+	item, err := encodeWinItem(userId, date, win)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// query input
+	input := &dynamodb.PutItemInput{
+		TableName:    aws.String(s.tableName),
+		Item:         item,
+		ReturnValues: types.ReturnValueNone,
+	}
+	if expectedVersion != "" {
+		unchanged, _, err := s.getWinUnchangedCondition(ctx, userId, date, expectedVersion)
+		if err != nil {
+			return err
+		}
+		expr, err := expression.NewBuilder().WithCondition(unchanged).Build()
+		if err != nil {
+			return logAndConvertError(err)
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
+
+	// run query
+	_, err = s.client.PutItem(ctx, input)
 	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return errConflict
+		}
 		return logAndConvertError(err)
 	}
-	svc := dynamodb.NewFromConfig(cfg)
 
+	// done
+	return nil
+}
+
+func encodeWinItem(userId string, date string, win winData) (map[string]types.AttributeValue, error) {
 	// define keys
 	hashKey := fmt.Sprintf("WIN#%s", userId)
 	sortKey := date
@@ -78,39 +179,308 @@ func updateWin(userId string, date string, win winData) error {
 
 	priorities, err := attributevalue.MarshalList(win.Priorities)
 	if err != nil {
-		return logAndConvertError(err)
+		return nil, err
+	}
+
+	item := map[string]types.AttributeValue{
+		WIN_TABLE_KEY:             &types.AttributeValueMemberS{Value: hashKey},
+		WIN_TABLE_SORT_KEY:        &types.AttributeValueMemberS{Value: sortKey},
+		WIN_TABLE_TEXT_ATTR:       &types.AttributeValueMemberS{Value: text},
+		WIN_TABLE_OVERALL_ATTR:    &types.AttributeValueMemberN{Value: overallResult},
+		WIN_TABLE_PRIORITIES_ATTR: &types.AttributeValueMemberL{Value: priorities},
+		WIN_TABLE_UPDATED_AT_ATTR: &types.AttributeValueMemberS{Value: generateTimestamp()},
+		WIN_TABLE_CHANGE_KEY:      &types.AttributeValueMemberS{Value: getChangeKey(userId)},
+	}
+
+	// wins saved before tags and entries were introduced do not have them
+	if len(win.Tags) > 0 {
+		tags, err := attributevalue.MarshalList(win.Tags)
+		if err != nil {
+			return nil, err
+		}
+		item[WIN_TABLE_TAGS_ATTR] = &types.AttributeValueMemberL{Value: tags}
+	}
+	if len(win.Entries) > 0 {
+		entries, err := attributevalue.MarshalList(encodeWinEntries(win.Entries))
+		if err != nil {
+			return nil, err
+		}
+		item[WIN_TABLE_ENTRIES_ATTR] = &types.AttributeValueMemberL{Value: entries}
+	}
+
+	return item, nil
+}
+
+// Reads the win consistently and compares it with the version the client expects, returns errConflict when they differ
+// Otherwise, returns the condition that only holds while the win stays the way it was read, and whether the win was found
+func (s *dynamoDbStore) getWinUnchangedCondition(ctx context.Context, userId string, date string, expectedVersion string) (expression.ConditionBuilder, bool, error) {
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	sortKey := date
+
+	// query expression
+	projection := expression.NamesList(
+		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_TEXT_ATTR),
+		expression.Name(WIN_TABLE_OVERALL_ATTR),
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_ENTRIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR),
+		expression.Name(WIN_TABLE_UPDATED_AT_ATTR))
+	expr, err := expression.NewBuilder().WithProjection(projection).Build()
+	if err != nil {
+		return expression.ConditionBuilder{}, false, logAndConvertError(err)
 	}
 
 	// query input
-	input := &dynamodb.PutItemInput{
-		TableName: aws.String(WIN_TABLE_NAME),
-		Item: map[string]types.AttributeValue{
-			WIN_TABLE_KEY:             &types.AttributeValueMemberS{Value: hashKey},
-			WIN_TABLE_SORT_KEY:        &types.AttributeValueMemberS{Value: sortKey},
-			WIN_TABLE_TEXT_ATTR:       &types.AttributeValueMemberS{Value: text},
-			WIN_TABLE_OVERALL_ATTR:    &types.AttributeValueMemberN{Value: overallResult},
-			WIN_TABLE_PRIORITIES_ATTR: &types.AttributeValueMemberL{Value: priorities},
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
+			WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
 		},
-		ReturnValues: types.ReturnValueNone,
+		ConsistentRead:           aws.Bool(true),
+		ExpressionAttributeNames: expr.Names(),
+		ProjectionExpression:     expr.Projection(),
 	}
 
 	// run query
-	_, err = svc.PutItem(context.TODO(), input)
+	result, err := s.client.GetItem(ctx, input)
 	if err != nil {
-		return logAndConvertError(err)
+		return expression.ConditionBuilder{}, false, logAndConvertError(err)
 	}
 
-	// done
+	// compare the versions
+	if result.Item == nil {
+		err = checkStoredWinVersion(nil, expectedVersion)
+		return expression.AttributeNotExists(expression.Name(WIN_TABLE_KEY)), false, err
+	}
+	winOnDay, err := decodeWinItem(result.Item)
+	if err != nil {
+		return expression.ConditionBuilder{}, false, err
+	}
+	err = checkStoredWinVersion(&winOnDay.Win, expectedVersion)
+	if err != nil {
+		return expression.ConditionBuilder{}, false, err
+	}
+
+	// every write stamps the win, the wins saved before that are only stamped by the next write
+	exists := expression.AttributeExists(expression.Name(WIN_TABLE_KEY))
+	updatedAt, ok := result.Item[WIN_TABLE_UPDATED_AT_ATTR].(*types.AttributeValueMemberS)
+	if !ok {
+		return exists.And(expression.AttributeNotExists(expression.Name(WIN_TABLE_UPDATED_AT_ATTR))), true, nil
+	}
+	return exists.And(expression.Name(WIN_TABLE_UPDATED_AT_ATTR).Equal(expression.Value(updatedAt.Value))), true, nil
+}
+
+// Writes wins in batches, dates are expected to be unique
+// The unprocessed items are retried, the ones that could not be written in the end are not reported as written
+func (s *dynamoDbStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	written := make([]string, 0, len(wins))
+	for start := 0; start < len(wins); start += BATCH_SIZE {
+		end := start + BATCH_SIZE
+		if end > len(wins) {
+			end = len(wins)
+		}
+
+		batchWritten, err := s.updateWinBatch(ctx, userId, wins[start:end])
+		written = append(written, batchWritten...)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// Returns the dates written, also when it fails
+// The deadline is applied before the wins are stamped and covers all the retries, so the wins are written
+// within the storage timeout from the stamp, the way the sync token expects, see getSyncToken
+func (s *dynamoDbStore) updateWinBatch(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	requests := make([]types.WriteRequest, 0, len(wins))
+	for _, winOnDay := range wins {
+		item, err := encodeWinItem(userId, winOnDay.Date, winOnDay.Win)
+		if err != nil {
+			return []string{}, logAndConvertError(err)
+		}
+		requests = append(requests, types.WriteRequest{
+			PutRequest: &types.PutRequest{
+				Item: item,
+			},
+		})
+	}
+
+	unprocessed, err := s.batchWriteWithRetry(ctx, requests)
+	notWritten := map[string]bool{}
+	for _, request := range unprocessed {
+		if sortKey, ok := request.PutRequest.Item[WIN_TABLE_SORT_KEY].(*types.AttributeValueMemberS); ok {
+			notWritten[sortKey.Value] = true
+		}
+	}
+	written := make([]string, 0, len(wins))
+	for _, winOnDay := range wins {
+		if !notWritten[winOnDay.Date] {
+			written = append(written, winOnDay.Date)
+		}
+	}
+
+	return written, err
+}
+
+// Writes up to BATCH_SIZE items, retrying the unprocessed ones the same way as the throttled calls
+func (s *dynamoDbStore) batchWrite(ctx context.Context, requests []types.WriteRequest) error {
+	_, err := s.batchWriteWithRetry(ctx, requests)
+	return err
+}
+
+// Returns the requests left unprocessed when it fails
+// The deadline covers all the attempts, the same way as with the retrying client
+func (s *dynamoDbStore) batchWriteWithRetry(ctx context.Context, requests []types.WriteRequest) ([]types.WriteRequest, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := s.batchWriteOnce(ctx, &requests)
+		if err != nil {
+			return requests, logAndConvertError(err)
+		}
+		if len(requests) == 0 {
+			return nil, nil
+		}
+		if attempt >= storageRetryMaxAttempts {
+			return requests, logAndConvertError(fmt.Errorf("%d items left unprocessed after %d attempts", len(requests), attempt))
+		}
+
+		err = waitBeforeRetry(ctx, attempt)
+		if err != nil {
+			return requests, logAndConvertError(err)
+		}
+		reststats.CountStorageRetry("BatchWriteItem")
+	}
+}
+
+func (s *dynamoDbStore) batchWriteOnce(ctx context.Context, requests *[]types.WriteRequest) error {
+	// query input
+	input := &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{
+			s.tableName: *requests,
+		},
+	}
+
+	result, err := s.client.BatchWriteItem(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	*requests = result.UnprocessedItems[s.tableName]
 	return nil
 }
 
-func getWin(userId string, date string) (*winData, error) {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// Translates the patch into the update expression, so the fields not in the patch are never overwritten
+func (s *dynamoDbStore) patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	sortKey := date
+
+	// update expression, the win created by the patch gets the defaults for the fields not in the patch
+	textName := expression.Name(WIN_TABLE_TEXT_ATTR)
+	overallName := expression.Name(WIN_TABLE_OVERALL_ATTR)
+	prioritiesName := expression.Name(WIN_TABLE_PRIORITIES_ATTR)
+	update := expression.Set(textName, expression.IfNotExists(textName, expression.Value("")))
+	if patch.Text != nil {
+		update = expression.Set(textName, expression.Value(base64.StdEncoding.EncodeToString([]byte(*patch.Text))))
+	}
+	if patch.OverallResult != nil {
+		update = update.Set(overallName, expression.Value(*patch.OverallResult))
+	} else {
+		update = update.Set(overallName, expression.IfNotExists(overallName, expression.Value(OVERALL_DAY_RESULT_NO_WIN_YET)))
+	}
+	if patch.Priorities != nil {
+		update = update.Set(prioritiesName, expression.Value(nonNilStrings(*patch.Priorities)))
+	} else {
+		update = update.Set(prioritiesName, expression.IfNotExists(prioritiesName, expression.Value([]string{})))
+	}
+	update = update.Set(expression.Name(WIN_TABLE_UPDATED_AT_ATTR), expression.Value(generateTimestamp()))
+	update = update.Set(expression.Name(WIN_TABLE_CHANGE_KEY), expression.Value(getChangeKey(userId)))
+	if patch.Tags != nil {
+		if len(*patch.Tags) > 0 {
+			update = update.Set(expression.Name(WIN_TABLE_TAGS_ATTR), expression.Value(*patch.Tags))
+		} else {
+			update = update.Remove(expression.Name(WIN_TABLE_TAGS_ATTR))
+		}
+	}
+
+	// text and priorities are derived from the entries, the version is checked the same way as in updateWin
+	conditions := []expression.ConditionBuilder{}
+	if patch.Text != nil || patch.Priorities != nil {
+		conditions = append(conditions, expression.AttributeNotExists(expression.Name(WIN_TABLE_ENTRIES_ATTR)))
+	}
+	if expectedVersion != "" {
+		unchanged, _, err := s.getWinUnchangedCondition(ctx, userId, date, expectedVersion)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, unchanged)
+	}
+
+	builder := expression.NewBuilder().WithUpdate(update)
+	switch len(conditions) {
+	case 1:
+		builder = builder.WithCondition(conditions[0])
+	case 2:
+		builder = builder.WithCondition(conditions[0].And(conditions[1]))
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// query input
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
+			WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              types.ReturnValueAllNew,
+	}
+
+	// run query
+	result, err := s.client.UpdateItem(ctx, input)
 	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil, errConflict
+		}
 		return nil, logAndConvertError(err)
 	}
-	svc := dynamodb.NewFromConfig(cfg)
+
+	// re-pack the results
+	winOnDay, err := decodeWinItem(result.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &winOnDay.Win, nil
+}
+
+func (s *dynamoDbStore) getWin(ctx context.Context, userId string, date string) (*winData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
 
 	// define keys
 	hashKey := fmt.Sprintf("WIN#%s", userId)
@@ -121,7 +491,9 @@ func getWin(userId string, date string) (*winData, error) {
 		expression.Name(WIN_TABLE_SORT_KEY),
 		expression.Name(WIN_TABLE_TEXT_ATTR),
 		expression.Name(WIN_TABLE_OVERALL_ATTR),
-		expression.Name(WIN_TABLE_PRIORITIES_ATTR))
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_ENTRIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR))
 	expr, err := expression.NewBuilder().WithProjection(projection).Build()
 	if err != nil {
 		return nil, logAndConvertError(err)
@@ -129,7 +501,7 @@ func getWin(userId string, date string) (*winData, error) {
 
 	// query input
 	input := &dynamodb.GetItemInput{
-		TableName: aws.String(WIN_TABLE_NAME),
+		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
 			WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
@@ -139,7 +511,7 @@ func getWin(userId string, date string) (*winData, error) {
 	}
 
 	// run query
-	result, err := svc.GetItem(context.TODO(), input)
+	result, err := s.client.GetItem(ctx, input)
 	if err != nil {
 		return nil, logAndConvertError(err)
 	}
@@ -148,8 +520,193 @@ func getWin(userId string, date string) (*winData, error) {
 	if result.Item == nil {
 		return nil, nil
 	}
+	winOnDay, err := decodeWinItem(result.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	return &winOnDay.Win, nil
+}
+
+// Reads the wins in batches, with strongly consistent reads
+func (s *dynamoDbStore) getWinsOnDates(ctx context.Context, userId string, dates []string) ([]winOnDayData, error) {
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	// query expression
+	projection := expression.NamesList(
+		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_TEXT_ATTR),
+		expression.Name(WIN_TABLE_OVERALL_ATTR),
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_ENTRIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR))
+	expr, err := expression.NewBuilder().WithProjection(projection).Build()
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	wins := make([]winOnDayData, 0, len(dates))
+	for start := 0; start < len(dates); start += BATCH_GET_SIZE {
+		end := start + BATCH_GET_SIZE
+		if end > len(dates) {
+			end = len(dates)
+		}
+
+		keys := make([]map[string]types.AttributeValue, 0, end-start)
+		for _, date := range dates[start:end] {
+			keys = append(keys, map[string]types.AttributeValue{
+				WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
+				WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: date},
+			})
+		}
+		keysAndAttributes := types.KeysAndAttributes{
+			Keys:                     keys,
+			ConsistentRead:           aws.Bool(true),
+			ExpressionAttributeNames: expr.Names(),
+			ProjectionExpression:     expr.Projection(),
+		}
+
+		items, err := s.batchGet(ctx, keysAndAttributes)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			winOnDay, err := decodeWinItem(item)
+			if err != nil {
+				return nil, err
+			}
+			wins = append(wins, *winOnDay)
+		}
+	}
+
+	return wins, nil
+}
+
+// Reads up to BATCH_GET_SIZE items, retrying the unprocessed keys the same way as the unprocessed writes
+func (s *dynamoDbStore) batchGet(ctx context.Context, keysAndAttributes types.KeysAndAttributes) ([]map[string]types.AttributeValue, error) {
+	items := make([]map[string]types.AttributeValue, 0, len(keysAndAttributes.Keys))
+	for attempt := 1; ; attempt++ {
+		pageCtx, cancel := withStorageTimeout(ctx)
+		result, err := s.client.BatchGetItem(pageCtx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				s.tableName: keysAndAttributes,
+			},
+		})
+		cancel()
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+
+		items = append(items, result.Responses[s.tableName]...)
+		unprocessed, ok := result.UnprocessedKeys[s.tableName]
+		if !ok || len(unprocessed.Keys) == 0 {
+			return items, nil
+		}
+		if attempt >= storageRetryMaxAttempts {
+			return nil, logAndConvertError(fmt.Errorf("%d keys left unprocessed after %d attempts", len(unprocessed.Keys), attempt))
+		}
+
+		err = waitBeforeRetry(ctx, attempt)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		reststats.CountStorageRetry("BatchGetItem")
+		keysAndAttributes = unprocessed
+	}
+}
+
+// Deletes the win and leaves the tombstone in one transaction
+func (s *dynamoDbStore) deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	tombstoneHashKey := fmt.Sprintf("DELETED#%s", userId)
+	sortKey := date
+
+	// only leave the tombstone when there was something to delete, and it is the version the client expects
+	condition := expression.AttributeExists(expression.Name(WIN_TABLE_KEY))
+	if expectedVersion != "" {
+		unchanged, found, err := s.getWinUnchangedCondition(ctx, userId, date, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
+		}
+		condition = unchanged
+	}
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// query input
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName: aws.String(s.tableName),
+					Key: map[string]types.AttributeValue{
+						WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
+						WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
+					},
+					ConditionExpression:       expr.Condition(),
+					ExpressionAttributeNames:  expr.Names(),
+					ExpressionAttributeValues: expr.Values(),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(s.tableName),
+					Item: map[string]types.AttributeValue{
+						WIN_TABLE_KEY:             &types.AttributeValueMemberS{Value: tombstoneHashKey},
+						WIN_TABLE_SORT_KEY:        &types.AttributeValueMemberS{Value: sortKey},
+						WIN_TABLE_UPDATED_AT_ATTR: &types.AttributeValueMemberS{Value: generateTimestamp()},
+						WIN_TABLE_CHANGE_KEY:      &types.AttributeValueMemberS{Value: getChangeKey(userId)},
+					},
+				},
+			},
+		},
+	}
+
+	// run query
+	_, err = s.client.TransactWriteItems(ctx, input)
+	if err != nil {
+		if isConditionalCheckCancellation(err) {
+			// with the version expected, the win has changed or been deleted since it was read
+			if expectedVersion != "" {
+				return errConflict
+			}
+			return nil
+		}
+		return logAndConvertError(err)
+	}
+
+	// done
+	return nil
+}
+
+// Tells whether the transaction was cancelled because the condition did not hold
+func isConditionalCheckCancellation(err error) bool {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return false
+	}
+	for _, reason := range cancelled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeWinItem(v map[string]types.AttributeValue) (*winOnDayData, error) {
 	item := winItem{}
-	err = attributevalue.UnmarshalMap(result.Item, &item)
+	err := attributevalue.UnmarshalMap(v, &item)
 	if err != nil {
 		return nil, logAndConvertError(err)
 	}
@@ -161,22 +718,29 @@ func getWin(userId string, date string) (*winData, error) {
 	if err != nil {
 		return nil, logAndConvertError(err)
 	}
+	entries, err := decodeWinEntries(item.Entries)
+	if err != nil {
+		return nil, err
+	}
 	win := winData{
 		Text:          string(textBytes),
 		OverallResult: overallResult,
 		Priorities:    item.Priorities,
+		Entries:       entries,
+		Tags:          item.Tags,
 	}
 
-	return &win, nil
+	return &winOnDayData{
+		Date: item.SortKey,
+		Win:  win,
+	}, nil
 }
 
-func updatePriorities(userId string, priorities priorityListData, updatedAt string) error {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return logAndConvertError(err)
-	}
-	svc := dynamodb.NewFromConfig(cfg)
+// When expectedVersion is not empty, only updates if the stored version matches, otherwise returns errConflict
+func (s *dynamoDbStore) updatePriorities(ctx context.Context, userId string, priorities priorityListData, updatedAt string, expectedVersion string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
 
 	// define keys
 	hashKey := "PRIORITIES"
@@ -190,7 +754,7 @@ func updatePriorities(userId string, priorities priorityListData, updatedAt stri
 
 	// query input
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String(WIN_TABLE_NAME),
+		TableName: aws.String(s.tableName),
 		Item: map[string]types.AttributeValue{
 			WIN_TABLE_KEY:             &types.AttributeValueMemberS{Value: hashKey},
 			WIN_TABLE_SORT_KEY:        &types.AttributeValueMemberS{Value: sortKey},
@@ -200,9 +764,25 @@ func updatePriorities(userId string, priorities priorityListData, updatedAt stri
 		ReturnValues: types.ReturnValueNone,
 	}
 
+	// condition expression
+	if expectedVersion != "" {
+		condition := expression.Name(WIN_TABLE_UPDATED_AT_ATTR).Equal(expression.Value(expectedVersion))
+		expr, err := expression.NewBuilder().WithCondition(condition).Build()
+		if err != nil {
+			return logAndConvertError(err)
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
+
 	// run query
-	_, err = svc.PutItem(context.TODO(), input)
+	_, err = s.client.PutItem(ctx, input)
 	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return errConflict
+		}
 		return logAndConvertError(err)
 	}
 
@@ -210,13 +790,11 @@ func updatePriorities(userId string, priorities priorityListData, updatedAt stri
 	return nil
 }
 
-func getPriorities(userId string) (*priorityListData, error) {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return nil, logAndConvertError(err)
-	}
-	svc := dynamodb.NewFromConfig(cfg)
+// Returns priorities together with their version
+func (s *dynamoDbStore) getPriorities(ctx context.Context, userId string) (*priorityListData, string, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
 
 	// define keys
 	hashKey := "PRIORITIES"
@@ -225,15 +803,16 @@ func getPriorities(userId string) (*priorityListData, error) {
 	// query expression
 	projection := expression.NamesList(
 		expression.Name(WIN_TABLE_SORT_KEY),
-		expression.Name(WIN_TABLE_ITEMS_ATTR))
+		expression.Name(WIN_TABLE_ITEMS_ATTR),
+		expression.Name(WIN_TABLE_UPDATED_AT_ATTR))
 	expr, err := expression.NewBuilder().WithProjection(projection).Build()
 	if err != nil {
-		return nil, logAndConvertError(err)
+		return nil, "", logAndConvertError(err)
 	}
 
 	// query input
 	input := &dynamodb.GetItemInput{
-		TableName: aws.String(WIN_TABLE_NAME),
+		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
 			WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
@@ -243,19 +822,19 @@ func getPriorities(userId string) (*priorityListData, error) {
 	}
 
 	// run query
-	result, err := svc.GetItem(context.TODO(), input)
+	result, err := s.client.GetItem(ctx, input)
 	if err != nil {
-		return nil, logAndConvertError(err)
+		return nil, "", logAndConvertError(err)
 	}
 
 	// re-pack the results
 	if result.Item == nil {
-		return nil, nil
+		return nil, "", nil
 	}
 	item := prioritiesListItem{}
 	err = attributevalue.UnmarshalMap(result.Item, &item)
 	if err != nil {
-		return nil, logAndConvertError(err)
+		return nil, "", logAndConvertError(err)
 	}
 
 	prioritiesToDecode := make([]priorityData, len(item.Items))
@@ -269,19 +848,26 @@ func getPriorities(userId string) (*priorityListData, error) {
 	}
 	prioritiesDecoded, err := decodePriorities(prioritiesToDecode)
 	if err != nil {
-		return nil, logAndConvertError(err)
+		return nil, "", logAndConvertError(err)
 	}
 
 	priorityList := priorityListData{
 		Items: prioritiesDecoded,
 	}
 
-	return &priorityList, nil
+	return &priorityList, item.UpdatedAt, nil
 }
 
+// The open circuit is not logged, it was already logged when the calls were failing
 func logAndConvertError(err error) error {
+	if errors.Is(err, errStorageCircuitOpen) {
+		return errStorageCircuitOpen
+	}
 	log.Printf("%v", err)
-	return fmt.Errorf("service unavailable")
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errStorageTimeout
+	}
+	return errStorageUnavailable
 }
 
 // base-64 encodes the priority text
@@ -361,14 +947,162 @@ func decodePriorities(priorities []priorityData) ([]priorityData, error) {
 	return decoded, nil
 }
 
+// Entry texts are stored the same way as the win text
+func encodeWinEntries(entries []winEntryData) []winEntryData {
+	encoded := make([]winEntryData, len(entries))
+	for i, e := range entries {
+		encoded[i] = winEntryData{
+			Id:         e.Id,
+			Text:       base64.StdEncoding.EncodeToString([]byte(e.Text)),
+			Priorities: e.Priorities,
+			CreatedAt:  e.CreatedAt,
+		}
+	}
+
+	return encoded
+}
+
+func decodeWinEntries(entries []winEntryData) ([]winEntryData, error) {
+	if entries == nil {
+		return nil, nil
+	}
+
+	decoded := make([]winEntryData, len(entries))
+	for i, e := range entries {
+		textBytes, err := base64.StdEncoding.DecodeString(e.Text)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+
+		decoded[i] = winEntryData{
+			Id:         e.Id,
+			Text:       string(textBytes),
+			Priorities: e.Priorities,
+			CreatedAt:  e.CreatedAt,
+		}
+	}
+
+	return decoded, nil
+}
+
 // Returns wins [from:to]
-func getWins(userId string, from string, to string) ([]winOnDayData, error) {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+func (s *dynamoDbStore) getWins(ctx context.Context, userId string, from string, to string) ([]winOnDayData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	// query expression
+	projection := expression.NamesList(
+		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_TEXT_ATTR),
+		expression.Name(WIN_TABLE_OVERALL_ATTR),
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_ENTRIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR))
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.KeyAnd(
+			expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
+			expression.KeyBetween(expression.Key(WIN_TABLE_SORT_KEY), expression.Value(from), expression.Value(to))),
+	).WithProjection(projection).Build()
 	if err != nil {
 		return nil, logAndConvertError(err)
 	}
-	svc := dynamodb.NewFromConfig(cfg)
+
+	// query input
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+	}
+
+	// run query
+	result, err := s.client.Query(ctx, input)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// re-pack the results
+	wins := make([]winOnDayData, len(result.Items))
+	for i, v := range result.Items {
+		winOnDay, err := decodeWinItem(v)
+		if err != nil {
+			return nil, err
+		}
+		wins[i] = *winOnDay
+	}
+
+	// done
+	return wins, nil
+}
+
+// Returns wins [from:to]
+func (s *dynamoDbStore) getWinDays(ctx context.Context, userId string, from string, to string) ([]string, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	// query expression
+	projection := expression.NamesList(
+		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_OVERALL_ATTR))
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.KeyAnd(
+			expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
+			expression.KeyBetween(expression.Key(WIN_TABLE_SORT_KEY), expression.Value(from), expression.Value(to))),
+	).WithProjection(projection).Build()
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+	}
+
+	// run query
+	result, err := s.client.Query(ctx, input)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// re-pack the results
+	days := make([]string, 0, len(result.Items))
+	for _, v := range result.Items {
+		item := winItem{}
+		err = attributevalue.UnmarshalMap(v, &item)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		overallResult, err := strconv.Atoi(item.Overall)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		if overallResult == OVERALL_DAY_RESULT_GOT_MY_WIN ||
+			overallResult == OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT {
+			days = append(days, item.SortKey)
+		}
+	}
+
+	// done
+	return days, nil
+}
+
+// Returns wins stats [from:to]
+func (s *dynamoDbStore) getWinDayStats(ctx context.Context, userId string, from string, to string) ([]winOnDayShortData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
 
 	// define keys
 	hashKey := fmt.Sprintf("WIN#%s", userId)
@@ -376,9 +1110,9 @@ func getWins(userId string, from string, to string) ([]winOnDayData, error) {
 	// query expression
 	projection := expression.NamesList(
 		expression.Name(WIN_TABLE_SORT_KEY),
-		expression.Name(WIN_TABLE_TEXT_ATTR),
 		expression.Name(WIN_TABLE_OVERALL_ATTR),
-		expression.Name(WIN_TABLE_PRIORITIES_ATTR))
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR))
 	expr, err := expression.NewBuilder().WithKeyCondition(
 		expression.KeyAnd(
 			expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
@@ -388,9 +1122,8 @@ func getWins(userId string, from string, to string) ([]winOnDayData, error) {
 		return nil, logAndConvertError(err)
 	}
 
-	// query input
 	input := &dynamodb.QueryInput{
-		TableName:                 aws.String(WIN_TABLE_NAME),
+		TableName:                 aws.String(s.tableName),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
@@ -398,183 +1131,428 @@ func getWins(userId string, from string, to string) ([]winOnDayData, error) {
 	}
 
 	// run query
-	result, err := svc.Query(context.TODO(), input)
+	result, err := s.client.Query(ctx, input)
 	if err != nil {
 		return nil, logAndConvertError(err)
 	}
 
-	// re-pack the results
-	wins := make([]winOnDayData, len(result.Items))
-	for i, v := range result.Items {
-		// TODO: extract into a separate method, to reuse in getWin
-		item := winItem{}
-		err = attributevalue.UnmarshalMap(v, &item)
-		if err != nil {
-			return nil, logAndConvertError(err)
-		}
-		overallResult, err := strconv.Atoi(item.Overall)
-		if err != nil {
-			return nil, logAndConvertError(err)
-		}
-		textBytes, err := base64.StdEncoding.DecodeString(item.Text)
+	// re-pack the results
+	wins := make([]winOnDayShortData, len(result.Items))
+	for i, v := range result.Items {
+		item := winItem{}
+		err = attributevalue.UnmarshalMap(v, &item)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		overallResult, err := strconv.Atoi(item.Overall)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		win := winShortData{
+			OverallResult: overallResult,
+			Priorities:    item.Priorities,
+			Tags:          item.Tags,
+		}
+
+		wins[i] = winOnDayShortData{
+			Date: item.SortKey,
+			Win:  win,
+		}
+	}
+
+	// done
+	return wins, nil
+}
+
+// Pages through all the wins of the user, in the order of dates
+func (s *dynamoDbStore) forEachWin(ctx context.Context, userId string, callback func(winOnDayData) error) error {
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	// query expression
+	projection := expression.NamesList(
+		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_TEXT_ATTR),
+		expression.Name(WIN_TABLE_OVERALL_ATTR),
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_ENTRIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR))
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
+	).WithProjection(projection).Build()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// query input
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+	}
+
+	// prepare paginator
+	paginator := dynamodb.NewQueryPaginator(s.client, input)
+
+	// retrieve everything
+	for paginator.HasMorePages() {
+		pageCtx, cancel := withStorageTimeout(ctx)
+		nextPage, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return logAndConvertError(err)
+		}
+
+		for _, item := range nextPage.Items {
+			winOnDay, err := decodeWinItem(item)
+			if err != nil {
+				return err
+			}
+			err = callback(*winOnDay)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// The first sync reads everything, including the wins saved before they got the change key
+// The next syncs only read the changes since the token, using the index on the update timestamp
+func (s *dynamoDbStore) getWinChanges(ctx context.Context, userId string, since string) ([]winChangeData, error) {
+	if since != "" {
+		return s.getWinChangesSince(ctx, userId, since)
+	}
+
+	changes := make([]winChangeData, 0)
+
+	// changed wins
+	projection := expression.NamesList(
+		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_TEXT_ATTR),
+		expression.Name(WIN_TABLE_OVERALL_ATTR),
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_ENTRIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR),
+		expression.Name(WIN_TABLE_UPDATED_AT_ATTR))
+	err := s.queryAllItems(ctx, fmt.Sprintf("WIN#%s", userId), projection, func(item map[string]types.AttributeValue) error {
+		timestamp := winTimestampData{}
+		err := attributevalue.UnmarshalMap(item, &timestamp)
+		if err != nil {
+			return logAndConvertError(err)
+		}
+		winOnDay, err := decodeWinItem(item)
+		if err != nil {
+			return err
+		}
+
+		changes = append(changes, winChangeData{
+			Date:      winOnDay.Date,
+			Win:       &winOnDay.Win,
+			UpdatedAt: timestamp.UpdatedAt,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// tombstones
+	projection = expression.NamesList(
+		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_UPDATED_AT_ATTR))
+	err = s.queryAllItems(ctx, fmt.Sprintf("DELETED#%s", userId), projection, func(item map[string]types.AttributeValue) error {
+		tombstone := winTimestampData{}
+		err := attributevalue.UnmarshalMap(item, &tombstone)
+		if err != nil {
+			return logAndConvertError(err)
+		}
+
+		changes = append(changes, winChangeData{
+			Date:      tombstone.SortKey,
+			Deleted:   true,
+			UpdatedAt: tombstone.UpdatedAt,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// The index is eventually consistent, the changes that are not in the index yet are returned with the next token,
+// since the sync token is moved back by the storage timeout
+func (s *dynamoDbStore) getWinChangesSince(ctx context.Context, userId string, since string) ([]winChangeData, error) {
+	// define keys
+	winHashKey := fmt.Sprintf("WIN#%s", userId)
+	tombstoneHashKey := fmt.Sprintf("DELETED#%s", userId)
+
+	// query expression
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.Key(WIN_TABLE_CHANGE_KEY).Equal(expression.Value(getChangeKey(userId))).And(
+			expression.Key(WIN_TABLE_UPDATED_AT_ATTR).GreaterThan(expression.Value(since))),
+	).Build()
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// query input
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		IndexName:                 aws.String(WIN_TABLE_CHANGES_INDEX),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+	}
+
+	// prepare paginator
+	paginator := dynamodb.NewQueryPaginator(s.client, input)
+
+	// retrieve everything
+	changes := make([]winChangeData, 0)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := withStorageTimeout(ctx)
+		nextPage, err := paginator.NextPage(pageCtx)
+		cancel()
 		if err != nil {
 			return nil, logAndConvertError(err)
 		}
-		win := winData{
-			Text:          string(textBytes),
-			OverallResult: overallResult,
-			Priorities:    item.Priorities,
-		}
 
-		wins[i] = winOnDayData{
-			Date: item.SortKey,
-			Win:  win,
+		for _, item := range nextPage.Items {
+			timestamp := winTimestampData{}
+			err = attributevalue.UnmarshalMap(item, &timestamp)
+			if err != nil {
+				return nil, logAndConvertError(err)
+			}
+
+			switch timestamp.Key {
+			case winHashKey:
+				winOnDay, err := decodeWinItem(item)
+				if err != nil {
+					return nil, err
+				}
+				changes = append(changes, winChangeData{
+					Date:      winOnDay.Date,
+					Win:       &winOnDay.Win,
+					UpdatedAt: timestamp.UpdatedAt,
+				})
+			case tombstoneHashKey:
+				changes = append(changes, winChangeData{
+					Date:      timestamp.SortKey,
+					Deleted:   true,
+					UpdatedAt: timestamp.UpdatedAt,
+				})
+			}
 		}
 	}
 
-	// done
-	return wins, nil
+	return changes, nil
 }
 
-// Returns wins [from:to]
-func getWinDays(userId string, from string, to string) ([]string, error) {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return nil, logAndConvertError(err)
-	}
-	svc := dynamodb.NewFromConfig(cfg)
-
-	// define keys
-	hashKey := fmt.Sprintf("WIN#%s", userId)
+func getChangeKey(userId string) string {
+	return fmt.Sprintf("CHANGES#%s", userId)
+}
 
+// Calls back for every item under the hash key
+func (s *dynamoDbStore) queryAllItems(ctx context.Context, hashKey string, projection expression.ProjectionBuilder, callback func(map[string]types.AttributeValue) error) error {
 	// query expression
-	projection := expression.NamesList(
-		expression.Name(WIN_TABLE_SORT_KEY),
-		expression.Name(WIN_TABLE_OVERALL_ATTR))
 	expr, err := expression.NewBuilder().WithKeyCondition(
-		expression.KeyAnd(
-			expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
-			expression.KeyBetween(expression.Key(WIN_TABLE_SORT_KEY), expression.Value(from), expression.Value(to))),
+		expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
 	).WithProjection(projection).Build()
 	if err != nil {
-		return nil, logAndConvertError(err)
+		return logAndConvertError(err)
 	}
 
+	// query input
 	input := &dynamodb.QueryInput{
-		TableName:                 aws.String(WIN_TABLE_NAME),
+		TableName:                 aws.String(s.tableName),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
 		ProjectionExpression:      expr.Projection(),
 	}
 
-	// run query
-	result, err := svc.Query(context.TODO(), input)
-	if err != nil {
-		return nil, logAndConvertError(err)
-	}
+	// prepare paginator
+	paginator := dynamodb.NewQueryPaginator(s.client, input)
 
-	// re-pack the results
-	days := make([]string, 0, len(result.Items))
-	for _, v := range result.Items {
-		item := winItem{}
-		err = attributevalue.UnmarshalMap(v, &item)
+	// retrieve everything
+	for paginator.HasMorePages() {
+		pageCtx, cancel := withStorageTimeout(ctx)
+		nextPage, err := paginator.NextPage(pageCtx)
+		cancel()
 		if err != nil {
-			return nil, logAndConvertError(err)
+			return logAndConvertError(err)
 		}
-		overallResult, err := strconv.Atoi(item.Overall)
+
+		for _, item := range nextPage.Items {
+			err = callback(item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Versions are stored as wins, keyed by the date and the version, so the versions of the same date are kept together
+func (s *dynamoDbStore) addWinVersions(ctx context.Context, userId string, versions []winVersionData) error {
+	// define keys
+	hashKey := fmt.Sprintf("HISTORY#%s", userId)
+
+	requests := make([]types.WriteRequest, 0, BATCH_SIZE)
+	for _, version := range versions {
+		// encode data
+		item, err := encodeWinItem(userId, version.Date, version.Win)
 		if err != nil {
-			return nil, logAndConvertError(err)
+			return logAndConvertError(err)
 		}
-		if overallResult == OVERALL_DAY_RESULT_GOT_MY_WIN ||
-			overallResult == OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT {
-			days = append(days, item.SortKey)
+		item[WIN_TABLE_KEY] = &types.AttributeValueMemberS{Value: hashKey}
+		item[WIN_TABLE_SORT_KEY] = &types.AttributeValueMemberS{Value: getWinVersionSortKey(version.Date, version.Version)}
+		item[WIN_TABLE_UPDATED_AT_ATTR] = &types.AttributeValueMemberS{Value: version.ReplacedAt}
+		// versions are not changes
+		delete(item, WIN_TABLE_CHANGE_KEY)
+
+		requests = append(requests, types.WriteRequest{
+			PutRequest: &types.PutRequest{
+				Item: item,
+			},
+		})
+
+		if len(requests) == BATCH_SIZE {
+			err = s.batchWrite(ctx, requests)
+			if err != nil {
+				return err
+			}
+			requests = make([]types.WriteRequest, 0, BATCH_SIZE)
 		}
 	}
 
-	// done
-	return days, nil
+	// last batch
+	if len(requests) > 0 {
+		return s.batchWrite(ctx, requests)
+	}
+
+	return nil
 }
 
-// Returns wins stats [from:to]
-func getWinDayStats(userId string, from string, to string) ([]winOnDayShortData, error) {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return nil, logAndConvertError(err)
+func (s *dynamoDbStore) getWinVersions(ctx context.Context, userId string, date string, limit int) ([]winVersionData, error) {
+	// the query does not accept the limit of 0
+	if limit <= 0 {
+		return []winVersionData{}, nil
 	}
-	svc := dynamodb.NewFromConfig(cfg)
+
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
 
 	// define keys
-	hashKey := fmt.Sprintf("WIN#%s", userId)
+	hashKey := fmt.Sprintf("HISTORY#%s", userId)
+	prefix := getWinVersionSortKey(date, "")
 
 	// query expression
 	projection := expression.NamesList(
 		expression.Name(WIN_TABLE_SORT_KEY),
+		expression.Name(WIN_TABLE_TEXT_ATTR),
 		expression.Name(WIN_TABLE_OVERALL_ATTR),
-		expression.Name(WIN_TABLE_PRIORITIES_ATTR))
+		expression.Name(WIN_TABLE_PRIORITIES_ATTR),
+		expression.Name(WIN_TABLE_ENTRIES_ATTR),
+		expression.Name(WIN_TABLE_TAGS_ATTR),
+		expression.Name(WIN_TABLE_UPDATED_AT_ATTR))
 	expr, err := expression.NewBuilder().WithKeyCondition(
 		expression.KeyAnd(
 			expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
-			expression.KeyBetween(expression.Key(WIN_TABLE_SORT_KEY), expression.Value(from), expression.Value(to))),
+			expression.Key(WIN_TABLE_SORT_KEY).BeginsWith(prefix)),
 	).WithProjection(projection).Build()
 	if err != nil {
 		return nil, logAndConvertError(err)
 	}
 
+	// query input, the most recent first
 	input := &dynamodb.QueryInput{
-		TableName:                 aws.String(WIN_TABLE_NAME),
+		TableName:                 aws.String(s.tableName),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
 		ProjectionExpression:      expr.Projection(),
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(int32(limit)),
 	}
 
-	// run query
-	result, err := svc.Query(context.TODO(), input)
+	// run query, the limit is small enough for the versions to fit into a single page
+	result, err := s.client.Query(ctx, input)
 	if err != nil {
 		return nil, logAndConvertError(err)
 	}
 
 	// re-pack the results
-	wins := make([]winOnDayShortData, len(result.Items))
-	for i, v := range result.Items {
-		item := winItem{}
-		err = attributevalue.UnmarshalMap(v, &item)
+	versions := make([]winVersionData, 0, len(result.Items))
+	for _, item := range result.Items {
+		timestamp := winTimestampData{}
+		err = attributevalue.UnmarshalMap(item, &timestamp)
 		if err != nil {
 			return nil, logAndConvertError(err)
 		}
-		overallResult, err := strconv.Atoi(item.Overall)
+		winOnDay, err := decodeWinItem(item)
 		if err != nil {
-			return nil, logAndConvertError(err)
+			return nil, err
 		}
-		win := winShortData{
-			OverallResult: overallResult,
-			Priorities:    item.Priorities,
+
+		versions = append(versions, winVersionData{
+			Date:       date,
+			Version:    timestamp.SortKey[len(prefix):],
+			ReplacedAt: timestamp.UpdatedAt,
+			Win:        winOnDay.Win,
+		})
+	}
+
+	return versions, nil
+}
+
+func (s *dynamoDbStore) deleteWinVersions(ctx context.Context, userId string, date string, versions []string) error {
+	// define keys
+	hashKey := fmt.Sprintf("HISTORY#%s", userId)
+
+	for start := 0; start < len(versions); start += BATCH_SIZE {
+		end := start + BATCH_SIZE
+		if end > len(versions) {
+			end = len(versions)
 		}
 
-		wins[i] = winOnDayShortData{
-			Date: item.SortKey,
-			Win:  win,
+		batch := make([]string, 0, end-start)
+		for _, version := range versions[start:end] {
+			batch = append(batch, getWinVersionSortKey(date, version))
+		}
+		err := s.deleteWinsInBatch(ctx, hashKey, batch)
+		if err != nil {
+			return err
 		}
 	}
 
-	// done
-	return wins, nil
+	return nil
 }
 
-func deleteAllWins(userId string) error {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return logAndConvertError(err)
+func (s *dynamoDbStore) deleteAllWins(ctx context.Context, userId string) error {
+	for _, hashKey := range []string{
+		fmt.Sprintf("WIN#%s", userId),
+		fmt.Sprintf("DELETED#%s", userId),
+		fmt.Sprintf("HISTORY#%s", userId),
+	} {
+		err := s.deleteAllItems(ctx, hashKey)
+		if err != nil {
+			return err
+		}
 	}
-	svc := dynamodb.NewFromConfig(cfg)
-
-	// define keys
-	hashKey := fmt.Sprintf("WIN#%s", userId)
+	return nil
+}
 
+// Deleting while paging through the items is safe, running it again only finds the items left
+func (s *dynamoDbStore) deleteAllItems(ctx context.Context, hashKey string) error {
 	// query expression
 	projection := expression.NamesList(
 		expression.Name(WIN_TABLE_SORT_KEY))
@@ -587,7 +1565,7 @@ func deleteAllWins(userId string) error {
 
 	// query input
 	input := &dynamodb.QueryInput{
-		TableName:                 aws.String(WIN_TABLE_NAME),
+		TableName:                 aws.String(s.tableName),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
@@ -595,7 +1573,7 @@ func deleteAllWins(userId string) error {
 	}
 
 	// prepare paginator
-	paginator := dynamodb.NewQueryPaginator(svc, input)
+	paginator := dynamodb.NewQueryPaginator(s.client, input)
 
 	// init batch
 	batch := make([]string, 0, BATCH_SIZE)
@@ -603,7 +1581,9 @@ func deleteAllWins(userId string) error {
 
 	// retrieve everything
 	for paginator.HasMorePages() {
-		nextPage, err := paginator.NextPage(context.TODO())
+		pageCtx, cancel := withStorageTimeout(ctx)
+		nextPage, err := paginator.NextPage(pageCtx)
+		cancel()
 		if err != nil {
 			return logAndConvertError(err)
 		}
@@ -618,9 +1598,9 @@ func deleteAllWins(userId string) error {
 			batch = append(batch, winRef.SortKey)
 			batchCnt = batchCnt + 1
 			if batchCnt == BATCH_SIZE {
-				err = deleteWinsInBatch(userId, batch)
+				err = s.deleteWinsInBatch(ctx, hashKey, batch)
 				if err != nil {
-					return logAndConvertError(err)
+					return err
 				}
 
 				// reset batch
@@ -632,26 +1612,17 @@ func deleteAllWins(userId string) error {
 
 	// last batch
 	if batchCnt > 0 {
-		err = deleteWinsInBatch(userId, batch)
+		err = s.deleteWinsInBatch(ctx, hashKey, batch)
 		if err != nil {
-			return logAndConvertError(err)
+			return err
 		}
 	}
 
 	return nil
 }
 
-func deleteWinsInBatch(userId string, batch []string) error {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return logAndConvertError(err)
-	}
-	svc := dynamodb.NewFromConfig(cfg)
-
-	// define keys
-	hashKey := fmt.Sprintf("WIN#%s", userId)
-
+// Unprocessed items are retried the same way as with the updates, so the batch is either deleted or fails as a whole
+func (s *dynamoDbStore) deleteWinsInBatch(ctx context.Context, hashKey string, batch []string) error {
 	requests := make([]types.WriteRequest, 0, BATCH_SIZE)
 	for _, sortKey := range batch {
 		requests = append(requests, types.WriteRequest{
@@ -664,45 +1635,242 @@ func deleteWinsInBatch(userId string, batch []string) error {
 		})
 	}
 
+	return s.batchWrite(ctx, requests)
+}
+
+func (s *dynamoDbStore) deletePriorities(ctx context.Context, userId string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "PRIORITIES"
+	sortKey := userId
+
 	// query input
-	input := &dynamodb.BatchWriteItemInput{
-		RequestItems: map[string][]types.WriteRequest{
-			WIN_TABLE_NAME: requests,
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
+			WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
 		},
 	}
 
-	_, err = svc.BatchWriteItem(context.TODO(), input)
+	// run query
+	_, err := s.client.DeleteItem(ctx, input)
 	if err != nil {
 		return logAndConvertError(err)
 	}
 
+	// done
 	return nil
 }
 
-func deletePriorities(userId string) error {
-	// get service
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+func (s *dynamoDbStore) saveDeletionRequest(ctx context.Context, userId string, request deletionRequestData, expected *deletionRequestData) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "DELETION"
+	sortKey := userId
+
+	// encode data
+	job, err := attributevalue.Marshal(request.Job)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	item := map[string]types.AttributeValue{
+		WIN_TABLE_KEY:               &types.AttributeValueMemberS{Value: hashKey},
+		WIN_TABLE_SORT_KEY:          &types.AttributeValueMemberS{Value: sortKey},
+		WIN_TABLE_REQUESTED_AT_ATTR: &types.AttributeValueMemberS{Value: request.RequestedAt},
+		WIN_TABLE_JOB_ATTR:          job,
+	}
+
+	// the request without purgeAt is never due
+	if request.PurgeAt != "" {
+		item[WIN_TABLE_PURGE_AT_ATTR] = &types.AttributeValueMemberS{Value: request.PurgeAt}
+	}
+
+	// query input
+	input := &dynamodb.PutItemInput{
+		TableName:    aws.String(s.tableName),
+		Item:         item,
+		ReturnValues: types.ReturnValueNone,
+	}
+	if expected != nil {
+		expr, err := expression.NewBuilder().WithCondition(getDeletionRequestUnchangedCondition(*expected)).Build()
+		if err != nil {
+			return logAndConvertError(err)
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
+
+	// run query
+	_, err = s.client.PutItem(ctx, input)
 	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return errConflict
+		}
 		return logAndConvertError(err)
 	}
-	svc := dynamodb.NewFromConfig(cfg)
+
+	// done
+	return nil
+}
+
+// Holds while the stored request is the one expected, the job changes with every step of the deletion
+func getDeletionRequestUnchangedCondition(expected deletionRequestData) expression.ConditionBuilder {
+	condition := expression.Name(WIN_TABLE_REQUESTED_AT_ATTR).Equal(expression.Value(expected.RequestedAt))
+
+	// requests made before the deletion became a job have no job yet
+	if expected.Job == (deletionJobData{}) {
+		condition = condition.And(expression.AttributeNotExists(expression.Name(WIN_TABLE_JOB_ATTR)).
+			Or(expression.Name(WIN_TABLE_JOB_ATTR).Equal(expression.Value(expected.Job))))
+	} else {
+		condition = condition.And(expression.Name(WIN_TABLE_JOB_ATTR).Equal(expression.Value(expected.Job)))
+	}
+
+	if expected.PurgeAt == "" {
+		return condition.And(expression.AttributeNotExists(expression.Name(WIN_TABLE_PURGE_AT_ATTR)))
+	}
+	return condition.And(expression.Name(WIN_TABLE_PURGE_AT_ATTR).Equal(expression.Value(expected.PurgeAt)))
+}
+
+func (s *dynamoDbStore) getDeletionRequest(ctx context.Context, userId string) (*deletionRequestData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
 
 	// define keys
-	hashKey := "PRIORITIES"
+	hashKey := "DELETION"
+	sortKey := userId
+
+	// query input
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
+			WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
+		},
+	}
+
+	// run query
+	result, err := s.client.GetItem(ctx, input)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// re-pack the results
+	if result.Item == nil {
+		return nil, nil
+	}
+	item := deletionRequestItem{}
+	err = attributevalue.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	return &deletionRequestData{
+		UserId:      item.SortKey,
+		RequestedAt: item.RequestedAt,
+		PurgeAt:     item.PurgeAt,
+		Job:         item.Job,
+	}, nil
+}
+
+// All the requests are kept under the same key, there are never many of them
+func (s *dynamoDbStore) getDueDeletionRequests(ctx context.Context, now string) ([]deletionRequestData, error) {
+	// define keys
+	hashKey := "DELETION"
+
+	// query expression
+	expr, err := expression.NewBuilder().WithKeyCondition(
+		expression.Key(WIN_TABLE_KEY).Equal(expression.Value(hashKey)),
+	).WithFilter(
+		expression.Name(WIN_TABLE_PURGE_AT_ATTR).LessThanEqual(expression.Value(now)),
+	).Build()
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// query input
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+	}
+
+	// prepare paginator
+	paginator := dynamodb.NewQueryPaginator(s.client, input)
+
+	// retrieve everything
+	requests := make([]deletionRequestData, 0)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := withStorageTimeout(ctx)
+		nextPage, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+
+		for _, v := range nextPage.Items {
+			item := deletionRequestItem{}
+			err = attributevalue.UnmarshalMap(v, &item)
+			if err != nil {
+				return nil, logAndConvertError(err)
+			}
+			requests = append(requests, deletionRequestData{
+				UserId:      item.SortKey,
+				RequestedAt: item.RequestedAt,
+				PurgeAt:     item.PurgeAt,
+				Job:         item.Job,
+			})
+		}
+	}
+
+	return requests, nil
+}
+
+func (s *dynamoDbStore) deleteDeletionRequest(ctx context.Context, userId string, expected *deletionRequestData) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "DELETION"
 	sortKey := userId
 
 	// query input
 	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String(WIN_TABLE_NAME),
+		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			WIN_TABLE_KEY:      &types.AttributeValueMemberS{Value: hashKey},
 			WIN_TABLE_SORT_KEY: &types.AttributeValueMemberS{Value: sortKey},
 		},
 	}
+	if expected != nil {
+		expr, err := expression.NewBuilder().WithCondition(getDeletionRequestUnchangedCondition(*expected)).Build()
+		if err != nil {
+			return logAndConvertError(err)
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
 
 	// run query
-	_, err = svc.DeleteItem(context.TODO(), input)
+	_, err := s.client.DeleteItem(ctx, input)
 	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return errConflict
+		}
 		return logAndConvertError(err)
 	}
 
@@ -1,9 +1,13 @@
 package app
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -222,3 +226,55 @@ func TestDropExtraPriorities(t *testing.T) {
 	decodedPriorities, _ := decodePriorities(encodePriorities(priorities, 3))
 	assert.True(t, reflect.DeepEqual(decodedPriorities, expectedEncoded))
 }
+
+// Leaves the items on the given dates unprocessed
+type unprocessingDynamoDbClient struct {
+	dynamoDbClient
+	unprocessed map[string]bool
+}
+
+func (c *unprocessingDynamoDbClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	output := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for table, requests := range params.RequestItems {
+		for _, request := range requests {
+			sortKey := request.PutRequest.Item[WIN_TABLE_SORT_KEY].(*types.AttributeValueMemberS).Value
+			if c.unprocessed[sortKey] {
+				output.UnprocessedItems[table] = append(output.UnprocessedItems[table], request)
+			}
+		}
+	}
+	return output, nil
+}
+
+func TestUpdateWinsReportsWrittenDates(t *testing.T) {
+	setupRetryPolicy(t, 1, time.Millisecond, 0)
+	store := &dynamoDbStore{
+		client:    &unprocessingDynamoDbClient{unprocessed: map[string]bool{"20211002": true}},
+		tableName: "winaday",
+	}
+
+	written, err := store.updateWins(context.Background(), "user", []winOnDayData{
+		{Date: "20211001", Win: winData{Text: "Ran"}},
+		{Date: "20211002", Win: winData{Text: "Walked"}},
+	})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"20211001"}, written)
+}
+
+func TestUpdateWinsRetriesWithinStorageTimeout(t *testing.T) {
+	setupRetryPolicy(t, 10, time.Second, 0)
+	defer SetStorageTimeout(storageTimeout)
+	SetStorageTimeout(time.Duration(50) * time.Millisecond)
+	store := &dynamoDbStore{
+		client:    &unprocessingDynamoDbClient{unprocessed: map[string]bool{"20211001": true}},
+		tableName: "winaday",
+	}
+	start := time.Now()
+
+	written, err := store.updateWins(context.Background(), "user", []winOnDayData{{Date: "20211001", Win: winData{Text: "Ran"}}})
+
+	assert.Equal(t, errStorageTimeout, err)
+	assert.Equal(t, []string{}, written)
+	assert.Less(t, time.Since(start), time.Second)
+}
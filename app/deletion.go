@@ -0,0 +1,474 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+var errDeletionPending = errors.New("account is scheduled for deletion")
+var errDeletionGracePeriodOver = errors.New("grace period is over, account deletion cannot be cancelled")
+
+// 0 deletes the data right away
+var accountDeletionGracePeriod = time.Duration(7*24) * time.Hour
+
+const (
+	DELETION_STATUS_SCHEDULED   = "scheduled"
+	DELETION_STATUS_IN_PROGRESS = "inProgress"
+	DELETION_STATUS_COMPLETED   = "completed"
+)
+
+// The deletion job runs the phases in this order
+// Every phase can be repeated, since it only finds the data that is left, so the failed job is resumed from the phase where it stopped
+var deletionPhases = []string{"wins", "priorities"}
+
+// PurgeAt is cleared once the job is completed, so the request is never due again
+type deletionRequestData struct {
+	UserId      string
+	RequestedAt string
+	PurgeAt     string
+	Job         deletionJobData
+}
+
+// The progress of the deletion, saved after every phase
+type deletionJobData struct {
+	Status      string `json:"status"`
+	Phase       string `json:"phase"`
+	StartedAt   string `json:"startedAt"`
+	CompletedAt string `json:"completedAt"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"lastError"`
+}
+
+type deletionStatusData struct {
+	Status      string `json:"status"`
+	RequestedAt string `json:"requestedAt"`
+	PurgeAt     string `json:"purgeAt,omitempty"`
+	Phase       string `json:"phase,omitempty"`
+	StartedAt   string `json:"startedAt,omitempty"`
+	CompletedAt string `json:"completedAt,omitempty"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"lastError,omitempty"`
+}
+
+// Hides the data of the account marked for deletion: reads return nothing, updates are rejected with errDeletionPending
+// The deletion request is checked on every call and is not cached, so this store should wrap the other layers, not be wrapped by them
+type softDeletionStore struct {
+	Store
+}
+
+// The purger goes around the soft deletion, so it can delete the hidden data
+var accountDeletionStore *softDeletionStore
+
+func SetAccountDeletionGracePeriod(gracePeriod time.Duration) {
+	accountDeletionGracePeriod = gracePeriod
+}
+
+func newSoftDeletionStore(store Store) *softDeletionStore {
+	return &softDeletionStore{
+		Store: store,
+	}
+}
+
+func (s *softDeletionStore) isDeletionPending(ctx context.Context, userId string) (bool, error) {
+	request, err := s.Store.getDeletionRequest(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	return request != nil && request.Job.Status != DELETION_STATUS_COMPLETED, nil
+}
+
+func (s *softDeletionStore) checkDeletionNotPending(ctx context.Context, userId string) error {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return errDeletionPending
+	}
+	return nil
+}
+
+func (s *softDeletionStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return err
+	}
+	return s.Store.updateWin(ctx, userId, date, win, expectedVersion)
+}
+
+func (s *softDeletionStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return nil, err
+	}
+	return s.Store.updateWins(ctx, userId, wins)
+}
+
+func (s *softDeletionStore) patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error) {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return nil, err
+	}
+	return s.Store.patchWin(ctx, userId, date, patch, expectedVersion)
+}
+
+func (s *softDeletionStore) getWin(ctx context.Context, userId string, date string) (*winData, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil || pending {
+		return nil, err
+	}
+	return s.Store.getWin(ctx, userId, date)
+}
+
+func (s *softDeletionStore) getWinsOnDates(ctx context.Context, userId string, dates []string) ([]winOnDayData, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return []winOnDayData{}, nil
+	}
+	return s.Store.getWinsOnDates(ctx, userId, dates)
+}
+
+func (s *softDeletionStore) deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return err
+	}
+	return s.Store.deleteWin(ctx, userId, date, expectedVersion)
+}
+
+func (s *softDeletionStore) getWins(ctx context.Context, userId string, from string, to string) ([]winOnDayData, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return []winOnDayData{}, nil
+	}
+	return s.Store.getWins(ctx, userId, from, to)
+}
+
+func (s *softDeletionStore) getWinDays(ctx context.Context, userId string, from string, to string) ([]string, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return []string{}, nil
+	}
+	return s.Store.getWinDays(ctx, userId, from, to)
+}
+
+func (s *softDeletionStore) getWinDayStats(ctx context.Context, userId string, from string, to string) ([]winOnDayShortData, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return []winOnDayShortData{}, nil
+	}
+	return s.Store.getWinDayStats(ctx, userId, from, to)
+}
+
+func (s *softDeletionStore) updatePriorities(ctx context.Context, userId string, priorities priorityListData, updatedAt string, expectedVersion string) error {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return err
+	}
+	return s.Store.updatePriorities(ctx, userId, priorities, updatedAt, expectedVersion)
+}
+
+func (s *softDeletionStore) getPriorities(ctx context.Context, userId string) (*priorityListData, string, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil || pending {
+		return nil, "", err
+	}
+	return s.Store.getPriorities(ctx, userId)
+}
+
+func (s *softDeletionStore) getWinChanges(ctx context.Context, userId string, since string) ([]winChangeData, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return []winChangeData{}, nil
+	}
+	return s.Store.getWinChanges(ctx, userId, since)
+}
+
+func (s *softDeletionStore) addWinVersions(ctx context.Context, userId string, versions []winVersionData) error {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return err
+	}
+	return s.Store.addWinVersions(ctx, userId, versions)
+}
+
+func (s *softDeletionStore) getWinVersions(ctx context.Context, userId string, date string, limit int) ([]winVersionData, error) {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return []winVersionData{}, nil
+	}
+	return s.Store.getWinVersions(ctx, userId, date, limit)
+}
+
+func (s *softDeletionStore) deleteWinVersions(ctx context.Context, userId string, date string, versions []string) error {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return err
+	}
+	return s.Store.deleteWinVersions(ctx, userId, date, versions)
+}
+
+func (s *softDeletionStore) forEachWin(ctx context.Context, userId string, callback func(winOnDayData) error) error {
+	pending, err := s.isDeletionPending(ctx, userId)
+	if err != nil || pending {
+		return err
+	}
+	return s.Store.forEachWin(ctx, userId, callback)
+}
+
+// Only the purger deletes all the data, so the deletion stays cancellable until then
+func (s *softDeletionStore) deleteAllWins(ctx context.Context, userId string) error {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return err
+	}
+	return s.Store.deleteAllWins(ctx, userId)
+}
+
+func (s *softDeletionStore) deletePriorities(ctx context.Context, userId string) error {
+	if err := s.checkDeletionNotPending(ctx, userId); err != nil {
+		return err
+	}
+	return s.Store.deletePriorities(ctx, userId)
+}
+
+// Runs the deletion job, resuming it from the phase where the previous attempt stopped
+// Every save expects the request to be the one saved before, so the job stops with errConflict
+// once the deletion is cancelled or the job is taken over by another instance
+func (s *softDeletionStore) runDeletionJob(ctx context.Context, request deletionRequestData) (deletionRequestData, error) {
+	job := &request.Job
+	if job.Status == DELETION_STATUS_COMPLETED {
+		return request, nil
+	}
+	expected := request
+	if job.Status != DELETION_STATUS_IN_PROGRESS {
+		job.Status = DELETION_STATUS_IN_PROGRESS
+		job.Phase = deletionPhases[0]
+		job.StartedAt = generateTimestamp()
+	}
+	job.Attempts++
+	job.LastError = ""
+
+	start := getDeletionPhaseIndex(job.Phase)
+	for i := start; i < len(deletionPhases); i++ {
+		job.Phase = deletionPhases[i]
+		err := s.Store.saveDeletionRequest(ctx, request.UserId, request, &expected)
+		if err != nil {
+			return request, err
+		}
+		expected = request
+
+		err = s.runDeletionPhase(ctx, request.UserId, job.Phase)
+		if err != nil {
+			// the job stays in progress, so it is resumed by the purger
+			job.LastError = err.Error()
+			if saveErr := s.Store.saveDeletionRequest(ctx, request.UserId, request, &expected); saveErr != nil {
+				log.Printf("could not save deletion progress of %s: %v", request.UserId, saveErr)
+			}
+			return request, err
+		}
+	}
+
+	job.Status = DELETION_STATUS_COMPLETED
+	job.Phase = ""
+	job.CompletedAt = generateTimestamp()
+	request.PurgeAt = ""
+	err := s.Store.saveDeletionRequest(ctx, request.UserId, request, &expected)
+	return request, err
+}
+
+// The user id is not compared, since the stores fill it from the key
+func isSameDeletionRequest(a deletionRequestData, b deletionRequestData) bool {
+	return a.RequestedAt == b.RequestedAt && a.PurgeAt == b.PurgeAt && a.Job == b.Job
+}
+
+// Goes around the soft deletion, since the data is hidden at this point
+func (s *softDeletionStore) runDeletionPhase(ctx context.Context, userId string, phase string) error {
+	switch phase {
+	case "wins":
+		return s.Store.deleteAllWins(ctx, userId)
+	case "priorities":
+		return s.Store.deletePriorities(ctx, userId)
+	}
+	return fmt.Errorf("unknown deletion phase '%s'", phase)
+}
+
+// Unknown phase means the job has not been started
+func getDeletionPhaseIndex(phase string) int {
+	for i, p := range deletionPhases {
+		if p == phase {
+			return i
+		}
+	}
+	return 0
+}
+
+func toDeletionStatus(request deletionRequestData) deletionStatusData {
+	status := request.Job.Status
+	if status == "" {
+		status = DELETION_STATUS_SCHEDULED
+	}
+
+	return deletionStatusData{
+		Status:      status,
+		RequestedAt: request.RequestedAt,
+		PurgeAt:     request.PurgeAt,
+		Phase:       request.Job.Phase,
+		StartedAt:   request.Job.StartedAt,
+		CompletedAt: request.Job.CompletedAt,
+		Attempts:    request.Job.Attempts,
+		LastError:   request.Job.LastError,
+	}
+}
+
+// Runs in the background, purging the accounts whose grace period is over
+// Every instance runs its own purger, purging the same account twice does no harm
+func StartAccountDeletionPurger(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purgeDueAccounts(context.Background(), time.Now())
+		}
+	}()
+}
+
+// Also picks up the jobs that failed before, they are resumed
+func purgeDueAccounts(ctx context.Context, now time.Time) {
+	requests, err := accountDeletionStore.getDueDeletionRequests(ctx, formatTimestamp(now))
+	if err != nil {
+		log.Printf("could not retrieve accounts to purge: %v", err)
+		return
+	}
+
+	for _, request := range requests {
+		request, err = accountDeletionStore.runDeletionJob(ctx, request)
+		if err == errConflict {
+			log.Printf("skipped purging account %s, the deletion has been cancelled or is run by another instance", request.UserId)
+			continue
+		}
+		if err != nil {
+			log.Printf("could not purge account %s, attempt %d: %v", request.UserId, request.Job.Attempts, err)
+			continue
+		}
+		log.Printf("purged account %s, deletion requested at %s", request.UserId, request.RequestedAt)
+	}
+}
+
+// Marks the account for deletion, repeated requests keep the original grace period
+// Once the grace period is over, the request runs the deletion job right away, resuming it if it failed before
+func handlePostDeleteAllData(c *gin.Context, userId string, email string) {
+	request, err := dataStore.getDeletionRequest(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	// the account deleted before can be deleted again
+	if request == nil || request.Job.Status == DELETION_STATUS_COMPLETED {
+		now := time.Now()
+		request = &deletionRequestData{
+			UserId:      userId,
+			RequestedAt: formatTimestamp(now),
+			PurgeAt:     formatTimestamp(now.Add(accountDeletionGracePeriod)),
+			Job: deletionJobData{
+				Status: DELETION_STATUS_SCHEDULED,
+			},
+		}
+		err = dataStore.saveDeletionRequest(c.Request.Context(), userId, *request, nil)
+		if err != nil {
+			toStorageError(c, err)
+			return
+		}
+	}
+
+	// no need to wait for the purger
+	if request.PurgeAt <= formatTimestamp(time.Now()) {
+		*request, err = accountDeletionStore.runDeletionJob(c.Request.Context(), *request)
+		if err == errConflict {
+			toDeletionRequestConflict(c, userId)
+			return
+		}
+		if err != nil {
+			toStorageError(c, err)
+			return
+		}
+	}
+
+	toSuccess(c, toDeletionStatus(*request))
+}
+
+func handleGetDeleteAllDataStatus(c *gin.Context, userId string, email string) {
+	request, err := dataStore.getDeletionRequest(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+	if request == nil {
+		toNotFound(c)
+		return
+	}
+
+	toSuccess(c, toDeletionStatus(*request))
+}
+
+func handlePostDeleteAllDataCancel(c *gin.Context, userId string, email string) {
+	request, err := dataStore.getDeletionRequest(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+	if request == nil || request.Job.Status == DELETION_STATUS_COMPLETED {
+		toNotFound(c)
+		return
+	}
+
+	// the data may already be partly deleted
+	if request.Job.Status == DELETION_STATUS_IN_PROGRESS || request.PurgeAt <= formatTimestamp(time.Now()) {
+		toConflict(c, errDeletionGracePeriodOver.Error(), toDeletionStatus(*request))
+		return
+	}
+
+	// the purger may have started since the request was read
+	err = dataStore.deleteDeletionRequest(c.Request.Context(), userId, request)
+	if err == errConflict {
+		toDeletionRequestConflict(c, userId)
+		return
+	}
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toNoContent(c)
+}
+
+// Responds with 409 and the current deletion status when the request has been changed concurrently
+func toDeletionRequestConflict(c *gin.Context, userId string) {
+	request, err := dataStore.getDeletionRequest(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+	if request == nil {
+		toConflict(c, errConflict.Error(), nil)
+		return
+	}
+	toConflict(c, errConflict.Error(), toDeletionStatus(*request))
+}
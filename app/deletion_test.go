@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSoftDeletionStore() {
+	accountDeletionStore = newSoftDeletionStore(NewInMemoryStore())
+	dataStore = accountDeletionStore
+	ctx := context.Background()
+	dataStore.updateWin(ctx, "user", "20211001", winData{Text: "Some text", Priorities: []string{}}, "")
+	dataStore.updatePriorities(ctx, "user", priorityListData{Items: []priorityData{{Id: "001", Text: "One"}}}, generateTimestamp(), "")
+}
+
+func TestDeletionRequestHidesData(t *testing.T) {
+	setupSoftDeletionStore()
+	ctx := context.Background()
+
+	code, _ := callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+
+	assert.Equal(t, http.StatusOK, code)
+	win, _ := dataStore.getWin(ctx, "user", "20211001")
+	assert.Nil(t, win)
+	wins, _ := dataStore.getWins(ctx, "user", "20210101", "20211231")
+	assert.Equal(t, 0, len(wins))
+	priorities, _, _ := dataStore.getPriorities(ctx, "user")
+	assert.Nil(t, priorities)
+	err := dataStore.updateWin(ctx, "user", "20211002", winData{Text: "New text"}, "")
+	assert.Equal(t, errDeletionPending, err)
+}
+
+func TestCancelDeletionRequest(t *testing.T) {
+	setupSoftDeletionStore()
+	ctx := context.Background()
+	callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/deletealldata/cancel", nil)
+
+	handlePostDeleteAllDataCancel(c, "user", "user@example.com")
+
+	assert.Equal(t, http.StatusNoContent, c.Writer.Status())
+	win, _ := dataStore.getWin(ctx, "user", "20211001")
+	assert.Equal(t, "Some text", win.Text)
+}
+
+func TestCancelMissingDeletionRequest(t *testing.T) {
+	setupSoftDeletionStore()
+
+	code, _ := callWinHandler(handlePostDeleteAllDataCancel, "POST", nil, "")
+
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestCancelDeletionRequestAfterGracePeriod(t *testing.T) {
+	setupSoftDeletionStore()
+	dataStore.saveDeletionRequest(context.Background(), "user", deletionRequestData{
+		RequestedAt: formatTimestamp(time.Now().Add(-2 * time.Hour)),
+		PurgeAt:     formatTimestamp(time.Now().Add(-time.Hour)),
+	}, nil)
+
+	code, _ := callWinHandler(handlePostDeleteAllDataCancel, "POST", nil, "")
+
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+func TestPurgeDueAccounts(t *testing.T) {
+	setupSoftDeletionStore()
+	ctx := context.Background()
+	callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+
+	purgeDueAccounts(ctx, time.Now())
+	request, _ := dataStore.getDeletionRequest(ctx, "user")
+	assert.NotNil(t, request)
+
+	purgeDueAccounts(ctx, time.Now().Add(accountDeletionGracePeriod+time.Minute))
+	request, _ = dataStore.getDeletionRequest(ctx, "user")
+	assert.Equal(t, DELETION_STATUS_COMPLETED, request.Job.Status)
+	assert.Equal(t, "", request.PurgeAt)
+	win, _ := dataStore.getWin(ctx, "user", "20211001")
+	assert.Nil(t, win)
+	err := dataStore.updateWin(ctx, "user", "20211002", winData{Text: "New text"}, "")
+	assert.Nil(t, err)
+}
+
+func TestDeleteAllDataWithoutGracePeriod(t *testing.T) {
+	defer SetAccountDeletionGracePeriod(accountDeletionGracePeriod)
+	SetAccountDeletionGracePeriod(0)
+	setupSoftDeletionStore()
+	ctx := context.Background()
+
+	code, _ := callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+
+	assert.Equal(t, http.StatusOK, code)
+	request, _ := dataStore.getDeletionRequest(ctx, "user")
+	assert.Equal(t, DELETION_STATUS_COMPLETED, request.Job.Status)
+	wins, _ := accountDeletionStore.Store.getWins(ctx, "user", "20210101", "20211231")
+	assert.Equal(t, 0, len(wins))
+}
+
+// Fails deleting the priorities the given number of times, counts how many times the wins were deleted
+type failingDeletionStore struct {
+	Store
+	failures    int
+	winsDeleted int
+}
+
+func (s *failingDeletionStore) deletePriorities(ctx context.Context, userId string) error {
+	if s.failures > 0 {
+		s.failures--
+		return errStorageUnavailable
+	}
+	return s.Store.deletePriorities(ctx, userId)
+}
+
+func (s *failingDeletionStore) deleteAllWins(ctx context.Context, userId string) error {
+	s.winsDeleted++
+	return s.Store.deleteAllWins(ctx, userId)
+}
+
+func TestDeletionJobIsResumed(t *testing.T) {
+	defer SetAccountDeletionGracePeriod(accountDeletionGracePeriod)
+	SetAccountDeletionGracePeriod(0)
+	setupSoftDeletionStore()
+	failingStore := &failingDeletionStore{Store: accountDeletionStore.Store, failures: 1}
+	accountDeletionStore = newSoftDeletionStore(failingStore)
+	dataStore = accountDeletionStore
+	ctx := context.Background()
+
+	code, _ := callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+
+	assert.Equal(t, http.StatusInternalServerError, code)
+	request, _ := dataStore.getDeletionRequest(ctx, "user")
+	assert.Equal(t, DELETION_STATUS_IN_PROGRESS, request.Job.Status)
+	assert.Equal(t, "priorities", request.Job.Phase)
+	assert.NotEqual(t, "", request.Job.LastError)
+	win, _ := dataStore.getWin(ctx, "user", "20211001")
+	assert.Nil(t, win)
+
+	code, _ = callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+
+	assert.Equal(t, http.StatusOK, code)
+	request, _ = dataStore.getDeletionRequest(ctx, "user")
+	assert.Equal(t, DELETION_STATUS_COMPLETED, request.Job.Status)
+	assert.Equal(t, 2, request.Job.Attempts)
+	assert.Equal(t, "", request.Job.LastError)
+	assert.Equal(t, 1, failingStore.winsDeleted)
+	priorities, _, _ := dataStore.getPriorities(ctx, "user")
+	assert.Nil(t, priorities)
+}
+
+func TestDeletionStatus(t *testing.T) {
+	setupSoftDeletionStore()
+	callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/deletealldata/status", nil)
+
+	handleGetDeleteAllDataStatus(c, "user", "user@example.com")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"scheduled"`)
+}
+
+// Starts the deletion job right before the deletion request is deleted, as the purger on another instance would
+type racingDeletionStore struct {
+	Store
+}
+
+func (s *racingDeletionStore) deleteDeletionRequest(ctx context.Context, userId string, expected *deletionRequestData) error {
+	request, _ := s.Store.getDeletionRequest(ctx, userId)
+	started := *request
+	started.Job = deletionJobData{Status: DELETION_STATUS_IN_PROGRESS, Phase: "wins", Attempts: 1}
+	s.Store.saveDeletionRequest(ctx, userId, started, request)
+	return s.Store.deleteDeletionRequest(ctx, userId, expected)
+}
+
+func TestCancelDeletionRequestRacingPurger(t *testing.T) {
+	setupSoftDeletionStore()
+	accountDeletionStore = newSoftDeletionStore(&racingDeletionStore{Store: accountDeletionStore.Store})
+	dataStore = accountDeletionStore
+	ctx := context.Background()
+	callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+
+	code, _ := callWinHandler(handlePostDeleteAllDataCancel, "POST", nil, "")
+
+	assert.Equal(t, http.StatusConflict, code)
+	request, _ := dataStore.getDeletionRequest(ctx, "user")
+	assert.Equal(t, DELETION_STATUS_IN_PROGRESS, request.Job.Status)
+}
+
+// Cancels the deletion while the wins are being deleted
+type cancellingDeletionStore struct {
+	Store
+}
+
+func (s *cancellingDeletionStore) deleteAllWins(ctx context.Context, userId string) error {
+	s.Store.deleteDeletionRequest(ctx, userId, nil)
+	return s.Store.deleteAllWins(ctx, userId)
+}
+
+func TestDeletionJobStopsWhenCancelled(t *testing.T) {
+	setupSoftDeletionStore()
+	accountDeletionStore = newSoftDeletionStore(&cancellingDeletionStore{Store: accountDeletionStore.Store})
+	dataStore = accountDeletionStore
+	ctx := context.Background()
+	callWinHandler(handlePostDeleteAllData, "POST", nil, "")
+	request, _ := dataStore.getDeletionRequest(ctx, "user")
+
+	_, err := accountDeletionStore.runDeletionJob(ctx, *request)
+
+	assert.Equal(t, errConflict, err)
+	request, _ = dataStore.getDeletionRequest(ctx, "user")
+	assert.Nil(t, request)
+}
+
+// Counts how many times the deletion request is read
+type countingDeletionReadStore struct {
+	Store
+	reads int
+}
+
+func (s *countingDeletionReadStore) getDeletionRequest(ctx context.Context, userId string) (*deletionRequestData, error) {
+	s.reads++
+	return s.Store.getDeletionRequest(ctx, userId)
+}
+
+func TestDeletionRequestIsReadOncePerUpdate(t *testing.T) {
+	store := &countingDeletionReadStore{Store: NewInMemoryStore()}
+	setupDataStore(store)
+	ctx := context.Background()
+	dataStore.updateWin(ctx, "user", "20211001", winData{Text: "First"}, "")
+	store.reads = 0
+
+	err := dataStore.updateWin(ctx, "user", "20211001", winData{Text: "Second"}, "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, store.reads)
+	versions, _ := dataStore.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, 1, len(versions))
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Converts the version into a strong ETag
+func toETag(version string) string {
+	return fmt.Sprintf("\"%s\"", version)
+}
+
+// Extracts the version from the ETag, tolerates the weak and unquoted ones
+func parseETag(etag string) string {
+	etag = strings.TrimSpace(etag)
+	etag = strings.TrimPrefix(etag, "W/")
+	return strings.Trim(etag, "\"")
+}
+
+// Returns the version the client expects to be modifying, empty string when not specified
+// "*" matches any version, so treated the same way as no precondition
+func getIfMatchVersion(c *gin.Context) string {
+	version := parseETag(c.GetHeader("If-Match"))
+	if version == "*" {
+		return ""
+	}
+	return version
+}
+
+func setETag(c *gin.Context, version string) {
+	if version != "" {
+		c.Header("ETag", toETag(version))
+	}
+}
+
+// Strong ETag of the response payload, changes whenever any byte of the response changes
+func getDataVersion(data interface{}) ([]byte, string, error) {
+	payload, err := json.Marshal(gin.H{"data": data})
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.Sum256(payload)
+	return payload, base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+// Checks If-None-Match header, which may contain a list of ETags
+func isNoneMatching(c *gin.Context, version string) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, etag := range strings.Split(header, ",") {
+		clientVersion := parseETag(etag)
+		if clientVersion == "*" || clientVersion == version {
+			return false
+		}
+	}
+	return true
+}
+
+// Same as toSuccess, but responds with 304 when the client already has the current version
+func toSuccessWithETag(c *gin.Context, data interface{}) {
+	payload, version, err := getDataVersion(data)
+	if err != nil {
+		toInternalServerError(c, err.Error())
+		return
+	}
+
+	setETag(c, version)
+	if !isNoneMatching(c, version) {
+		toNotModified(c)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", payload)
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseETag(t *testing.T) {
+	assert.Equal(t, "abc", parseETag("\"abc\""))
+	assert.Equal(t, "abc", parseETag("W/\"abc\""))
+	assert.Equal(t, "abc", parseETag(" abc "))
+}
+
+func TestDataVersionChangesWithData(t *testing.T) {
+	_, version1, _ := getDataVersion(winData{Text: "One", Priorities: []string{}})
+	_, version2, _ := getDataVersion(winData{Text: "One", Priorities: []string{}})
+	_, version3, _ := getDataVersion(winData{Text: "Two", Priorities: []string{}})
+
+	assert.Equal(t, version1, version2)
+	assert.NotEqual(t, version1, version3)
+}
+
+func TestRespondNotModifiedWhenETagMatches(t *testing.T) {
+	data := winDayListData{Items: []string{"20211001"}}
+	_, version, _ := getDataVersion(data)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/windays/20211001/20211002", nil)
+	c.Request.Header.Set("If-None-Match", "\"other\", "+toETag(version))
+
+	toSuccessWithETag(c, data)
+	c.Writer.WriteHeaderNow()
+
+	assert.Equal(t, 304, w.Code)
+	assert.Equal(t, toETag(version), w.Header().Get("ETag"))
+}
+
+func TestRespondWithDataWhenETagDoesNotMatch(t *testing.T) {
+	data := winDayListData{Items: []string{"20211001"}}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/windays/20211001/20211002", nil)
+	c.Request.Header.Set("If-None-Match", "\"other\"")
+
+	toSuccessWithETag(c, data)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "{\"data\":{\"items\":[\"20211001\"]}}", w.Body.String())
+}
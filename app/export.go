@@ -0,0 +1,180 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EXPORT_FORMAT_JSON = "json"
+	EXPORT_FORMAT_CSV  = "csv"
+)
+
+// Sent after the body, so the clients can tell the complete export from the one cut short, without parsing it
+const (
+	EXPORT_STATUS_TRAILER  = "X-Export-Status"
+	EXPORT_STATUS_COMPLETE = "complete"
+	EXPORT_STATUS_FAILED   = "failed"
+)
+
+var errExportIncomplete = errors.New("export failed halfway, the data is incomplete, try again")
+
+// The document produced by the JSON export and accepted back by the import
+// Error is only set when the export failed halfway, then the wins are incomplete
+type exportData struct {
+	Priorities []priorityData `json:"priorities"`
+	Wins       []winOnDayData `json:"wins"`
+	Error      string         `json:"error,omitempty"`
+}
+
+type exportFormatContainerData struct {
+	Format string `form:"format"`
+}
+
+func handleGetExport(c *gin.Context, userId string, email string) {
+	// get format from the query string or Accept header
+	var formatContainer exportFormatContainerData
+	if err := c.ShouldBindQuery(&formatContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+	format := formatContainer.Format
+	if format == "" {
+		format = getExportFormatFromAcceptHeader(c.GetHeader("Accept"))
+	}
+
+	// sanitize
+	if format != EXPORT_FORMAT_JSON && format != EXPORT_FORMAT_CSV {
+		err := fmt.Errorf("invalid value '%s' for 'format', should be '%s' or '%s'",
+			format,
+			EXPORT_FORMAT_JSON,
+			EXPORT_FORMAT_CSV)
+		toBadRequest(c, err)
+		return
+	}
+
+	priorityList, _, err := dataStore.getPriorities(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+	priorities := []priorityData{}
+	if priorityList != nil {
+		priorities = priorityList.Items
+	}
+
+	if format == EXPORT_FORMAT_CSV {
+		exportAsCsv(c, userId, priorities)
+	} else {
+		exportAsJson(c, userId, priorities)
+	}
+}
+
+func getExportFormatFromAcceptHeader(accept string) string {
+	if strings.Contains(accept, "text/csv") {
+		return EXPORT_FORMAT_CSV
+	}
+	return EXPORT_FORMAT_JSON
+}
+
+// Streams the wins as they are retrieved from the storage, never keeps all of them in memory
+func exportAsJson(c *gin.Context, userId string, priorities []priorityData) {
+	prioritiesJson, err := json.Marshal(priorities)
+	if err != nil {
+		toInternalServerError(c, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=\"winaday.json\"")
+	c.Header("Trailer", EXPORT_STATUS_TRAILER)
+	c.Status(http.StatusOK)
+
+	fmt.Fprintf(c.Writer, "{\"priorities\":%s,\"wins\":[", prioritiesJson)
+	isFirst := true
+	err = dataStore.forEachWin(c.Request.Context(), userId, func(winOnDay winOnDayData) error {
+		winOnDay.Win = normalizeWin(winOnDay.Win)
+		winJson, err := json.Marshal(winOnDay)
+		if err != nil {
+			return err
+		}
+
+		if !isFirst {
+			c.Writer.WriteString(",")
+		}
+		isFirst = false
+		_, err = c.Writer.Write(winJson)
+		return err
+	})
+	if err != nil {
+		// the document stays valid, but carries the error instead of being complete
+		errorJson, _ := json.Marshal(errExportIncomplete.Error())
+		fmt.Fprintf(c.Writer, "],\"error\":%s}", errorJson)
+		abortExport(c, err)
+		return
+	}
+	c.Writer.WriteString("]}")
+	c.Writer.Header().Set(EXPORT_STATUS_TRAILER, EXPORT_STATUS_COMPLETE)
+}
+
+// Priorities are exported by their text, so the file is readable in the spreadsheet
+func exportAsCsv(c *gin.Context, userId string, priorities []priorityData) {
+	priorityTextById := map[string]string{}
+	for _, p := range priorities {
+		priorityTextById[p.Id] = p.Text
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=\"winaday.csv\"")
+	c.Header("Trailer", EXPORT_STATUS_TRAILER)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"date", "overall", "text", "priorities", "tags"})
+	err := dataStore.forEachWin(c.Request.Context(), userId, func(winOnDay winOnDayData) error {
+		priorityTexts := make([]string, 0, len(winOnDay.Win.Priorities))
+		for _, id := range winOnDay.Win.Priorities {
+			text, ok := priorityTextById[id]
+			if !ok {
+				text = id
+			}
+			priorityTexts = append(priorityTexts, text)
+		}
+
+		return writer.Write([]string{
+			winOnDay.Date,
+			strconv.Itoa(winOnDay.Win.OverallResult),
+			winOnDay.Win.Text,
+			strings.Join(priorityTexts, "; "),
+			strings.Join(winOnDay.Win.Tags, "; "),
+		})
+	})
+	if err != nil {
+		// the last row tells the user reading the file in the spreadsheet
+		writer.Write([]string{"ERROR", "", errExportIncomplete.Error(), "", ""})
+		writer.Flush()
+		abortExport(c, err)
+		return
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		abortExport(c, err)
+		return
+	}
+	c.Writer.Header().Set(EXPORT_STATUS_TRAILER, EXPORT_STATUS_COMPLETE)
+}
+
+// The status has already been sent, so the failure is reported at the end of the document and in the trailer
+func abortExport(c *gin.Context, err error) {
+	log.Printf("export failed: %v", err)
+	c.Writer.Header().Set(EXPORT_STATUS_TRAILER, EXPORT_STATUS_FAILED)
+	c.Abort()
+}
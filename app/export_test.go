@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupExportTestData() {
+	ctx := context.Background()
+	dataStore = NewInMemoryStore()
+	dataStore.updatePriorities(ctx, "user", priorityListData{
+		Items: []priorityData{{Id: "001", Text: "Health", Color: 1}},
+	}, "v1", "")
+	dataStore.updateWin(ctx, "user", "20211002", winData{Text: "Ran, \"fast\"", OverallResult: 1, Priorities: []string{"001"}, Tags: []string{"sport", "outdoor"}}, "")
+	dataStore.updateWin(ctx, "user", "20211001", winData{Text: "Rested", OverallResult: 2}, "")
+}
+
+func TestExportAsJson(t *testing.T) {
+	setupExportTestData()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/export", nil)
+
+	handleGetExport(c, "user", "user@example.com")
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, EXPORT_STATUS_COMPLETE, w.Result().Trailer.Get(EXPORT_STATUS_TRAILER))
+	assert.Equal(t,
+		"{\"priorities\":[{\"id\":\"001\",\"text\":\"Health\",\"color\":1,\"deleted\":false}],\"wins\":["+
+			"{\"date\":\"20211001\",\"win\":{\"text\":\"Rested\",\"overall\":2,\"priorities\":[],"+
+			"\"entries\":[{\"id\":\"legacy\",\"text\":\"Rested\",\"priorities\":[],\"createdAt\":\"\"}],\"tags\":[]}},"+
+			"{\"date\":\"20211002\",\"win\":{\"text\":\"Ran, \\\"fast\\\"\",\"overall\":1,\"priorities\":[\"001\"],"+
+			"\"entries\":[{\"id\":\"legacy\",\"text\":\"Ran, \\\"fast\\\"\",\"priorities\":[\"001\"],\"createdAt\":\"\"}],\"tags\":[\"sport\",\"outdoor\"]}}]}",
+		w.Body.String())
+}
+
+func TestExportAsCsv(t *testing.T) {
+	setupExportTestData()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/export", nil)
+	c.Request.Header.Set("Accept", "text/csv")
+
+	handleGetExport(c, "user", "user@example.com")
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, EXPORT_STATUS_COMPLETE, w.Result().Trailer.Get(EXPORT_STATUS_TRAILER))
+	assert.Equal(t,
+		"date,overall,text,priorities,tags\n"+
+			"20211001,2,Rested,,\n"+
+			"20211002,1,\"Ran, \"\"fast\"\"\",Health,sport; outdoor\n",
+		w.Body.String())
+}
+
+// Fails after the first win, the way the storage failing halfway through the export would
+type failingExportStore struct {
+	Store
+}
+
+func (s *failingExportStore) forEachWin(ctx context.Context, userId string, callback func(winOnDayData) error) error {
+	failed := false
+	return s.Store.forEachWin(ctx, userId, func(winOnDay winOnDayData) error {
+		if failed {
+			return errStorageUnavailable
+		}
+		failed = true
+		return callback(winOnDay)
+	})
+}
+
+func TestExportFailedHalfwayIsMarkedAsIncomplete(t *testing.T) {
+	setupExportTestData()
+	dataStore = &failingExportStore{Store: dataStore}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/export", nil)
+
+	handleGetExport(c, "user", "user@example.com")
+
+	assert.Equal(t, EXPORT_STATUS_FAILED, w.Result().Trailer.Get(EXPORT_STATUS_TRAILER))
+	var exported exportData
+	err := json.Unmarshal(w.Body.Bytes(), &exported)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(exported.Wins))
+	assert.Equal(t, errExportIncomplete.Error(), exported.Error)
+
+	code, _ := postImport("?mode=replace", w.Body.String())
+
+	assert.Equal(t, 400, code)
+}
+
+func TestCsvExportFailedHalfwayIsMarkedAsIncomplete(t *testing.T) {
+	setupExportTestData()
+	dataStore = &failingExportStore{Store: dataStore}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/export?format=csv", nil)
+
+	handleGetExport(c, "user", "user@example.com")
+
+	assert.Equal(t, EXPORT_STATUS_FAILED, w.Result().Trailer.Get(EXPORT_STATUS_TRAILER))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasPrefix(lines[2], "ERROR,"))
+}
@@ -0,0 +1,350 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 0 versions disables the history, 0 age keeps the versions until there are too many of them
+var winHistoryMaxVersions = 10
+var winHistoryMaxAge = time.Duration(30*24) * time.Hour
+
+// Bounds the work of pruning on a single update, whatever is left is pruned on the later updates and filtered out on read
+const WIN_HISTORY_PRUNE_MAX_DATES = 10
+const WIN_HISTORY_PRUNE_MAX_VERSIONS = 10
+
+// The win as it was before it was replaced
+// Version is the time of the replacement in nanoseconds, so the versions sort in the order they were made
+type winVersionData struct {
+	Date       string  `json:"date"`
+	Version    string  `json:"version"`
+	ReplacedAt string  `json:"replacedAt"`
+	Win        winData `json:"win"`
+}
+
+type winHistoryData struct {
+	Items []winVersionData `json:"items"`
+}
+
+type winVersionContainerData struct {
+	Date    string `uri:"dt" binding:"required"`
+	Version string `uri:"version" binding:"required"`
+}
+
+// Keeps the previous version of the win on every update made through this store
+// The version is only kept once the update succeeds, so the rejected or failed update leaves the history as it was
+// The single win is written expecting it to be the one read before, so the version kept is the one actually replaced,
+// the batch is not, so the concurrent updates of the same win may not all be kept
+type historyStore struct {
+	Store
+}
+
+// Without the expected version, the write is retried this many times when the win changes between the read and the write
+const WIN_HISTORY_WRITE_MAX_ATTEMPTS = 3
+
+func SetWinHistoryRetention(maxVersions int, maxAge time.Duration) {
+	winHistoryMaxVersions = maxVersions
+	winHistoryMaxAge = maxAge
+}
+
+func newHistoryStore(store Store) Store {
+	return &historyStore{
+		Store: store,
+	}
+}
+
+func (s *historyStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	return s.writeKeepingVersion(ctx, userId, date, expectedVersion, func(currentVersion string) (*winData, error) {
+		err := s.Store.updateWin(ctx, userId, date, win, currentVersion)
+		return &win, err
+	})
+}
+
+func (s *historyStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	if winHistoryMaxVersions <= 0 {
+		return s.Store.updateWins(ctx, userId, wins)
+	}
+
+	current, err := s.getCurrentWins(ctx, userId, wins)
+	if err != nil {
+		return nil, err
+	}
+
+	written, err := s.Store.updateWins(ctx, userId, wins)
+
+	// the wins not written are still the current ones
+	isWritten := map[string]bool{}
+	for _, date := range written {
+		isWritten[date] = true
+	}
+	replaced := make([]winOnDayData, 0, len(written))
+	for _, winOnDay := range wins {
+		if isWritten[winOnDay.Date] {
+			replaced = append(replaced, winOnDay)
+		}
+	}
+	s.keepVersions(ctx, userId, current, replaced)
+
+	return written, err
+}
+
+func (s *historyStore) patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error) {
+	var patched *winData
+	err := s.writeKeepingVersion(ctx, userId, date, expectedVersion, func(currentVersion string) (*winData, error) {
+		var err error
+		patched, err = s.Store.patchWin(ctx, userId, date, patch, currentVersion)
+		return patched, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// The deleted win is kept as well, so the deletion can be undone
+func (s *historyStore) deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error {
+	return s.writeKeepingVersion(ctx, userId, date, expectedVersion, func(currentVersion string) (*winData, error) {
+		return &winData{}, s.Store.deleteWin(ctx, userId, date, currentVersion)
+	})
+}
+
+// Reads the current win and writes expecting it to be unchanged, then keeps the current win as the version
+// The write gets the version of the win it should replace and returns the win it has written
+func (s *historyStore) writeKeepingVersion(ctx context.Context, userId string, date string, expectedVersion string,
+	write func(currentVersion string) (*winData, error)) error {
+	if winHistoryMaxVersions <= 0 {
+		_, err := write(expectedVersion)
+		return err
+	}
+
+	conflictedVersion := ""
+	for attempt := 1; ; attempt++ {
+		current, err := s.getCurrentWins(ctx, userId, []winOnDayData{{Date: date}})
+		if err != nil {
+			return err
+		}
+		var currentWin *winData
+		if win, ok := current[date]; ok {
+			currentWin = &win
+		}
+		currentVersion, err := getStoredWinVersion(currentWin)
+		if err != nil {
+			return err
+		}
+
+		// the win has not changed, so the conflict was not about the version (e.g. patching the text of the win with entries)
+		if currentVersion == conflictedVersion {
+			return errConflict
+		}
+		if expectedVersion != "" && currentVersion != expectedVersion {
+			return errConflict
+		}
+
+		written, err := write(currentVersion)
+		if err == errConflict && expectedVersion == "" && attempt < WIN_HISTORY_WRITE_MAX_ATTEMPTS {
+			conflictedVersion = currentVersion
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		s.keepVersions(ctx, userId, current, []winOnDayData{{Date: date, Win: *written}})
+		return nil
+	}
+}
+
+// Saves the versions of the wins that have been replaced, skipping the ones that stayed the same
+// The wins are already written, so the failure to keep the version is only logged
+func (s *historyStore) keepVersions(ctx context.Context, userId string, current map[string]winData, updates []winOnDayData) {
+	now := time.Now()
+	versions := make([]winVersionData, 0, len(updates))
+	for _, update := range updates {
+		win, ok := current[update.Date]
+		if !ok || reflect.DeepEqual(normalizeWin(win), normalizeWin(update.Win)) {
+			continue
+		}
+		versions = append(versions, winVersionData{
+			Date:       update.Date,
+			Version:    strconv.FormatInt(now.UnixNano(), 10),
+			ReplacedAt: formatTimestamp(now),
+			Win:        win,
+		})
+	}
+	if len(versions) == 0 {
+		return
+	}
+
+	err := s.Store.addWinVersions(ctx, userId, versions)
+	if err != nil {
+		log.Printf("could not keep the previous versions of the wins of %s: %v", userId, err)
+		return
+	}
+
+	// the dates are picked at random, so the big batches repeated over time get all their dates pruned
+	pruned := rand.Perm(len(versions))
+	if len(pruned) > WIN_HISTORY_PRUNE_MAX_DATES {
+		pruned = pruned[:WIN_HISTORY_PRUNE_MAX_DATES]
+	}
+	for _, i := range pruned {
+		err = s.pruneVersions(ctx, userId, versions[i].Date, now)
+		if err != nil {
+			log.Printf("could not prune the versions of the win of %s on %s: %v", userId, versions[i].Date, err)
+			return
+		}
+	}
+}
+
+// Reads only the updated dates, bypassing the cache, so the version kept is the one actually replaced
+func (s *historyStore) getCurrentWins(ctx context.Context, userId string, updates []winOnDayData) (map[string]winData, error) {
+	dates := make([]string, 0, len(updates))
+	for _, update := range updates {
+		dates = append(dates, update.Date)
+	}
+	wins, err := s.Store.getWinsOnDates(ctx, userId, dates)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]winData{}
+	for _, winOnDay := range wins {
+		current[winOnDay.Date] = winOnDay.Win
+	}
+
+	return current, nil
+}
+
+// Deletes the versions that are over the limit or too old, reading no more than the limit allows to delete
+func (s *historyStore) pruneVersions(ctx context.Context, userId string, date string, now time.Time) error {
+	versions, err := s.Store.getWinVersions(ctx, userId, date, winHistoryMaxVersions+WIN_HISTORY_PRUNE_MAX_VERSIONS)
+	if err != nil {
+		return err
+	}
+
+	expired := []string{}
+	for i, version := range versions {
+		if i >= winHistoryMaxVersions || isWinVersionExpired(version, now) {
+			expired = append(expired, version.Version)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	return s.Store.deleteWinVersions(ctx, userId, date, expired)
+}
+
+func handleGetWinHistory(c *gin.Context, userId string, email string) {
+	// get date from URL
+	var dateContainer dateContainerData
+	if err := c.ShouldBindUri(&dateContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// sanitize
+	if !isDateValid(dateContainer.Date) {
+		err := fmt.Errorf("invalid value '%s' for 'date'", dateContainer.Date)
+		toBadRequest(c, err)
+		return
+	}
+
+	versions, err := getRetainedWinVersions(c.Request.Context(), userId, dateContainer.Date)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toSuccess(c, winHistoryData{Items: versions})
+}
+
+// Restoring is an update, so the version being replaced is kept in the history as well and the restore can be undone
+func handlePostWinRestore(c *gin.Context, userId string, email string) {
+	// get date and version from URL
+	var versionContainer winVersionContainerData
+	if err := c.ShouldBindUri(&versionContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// sanitize
+	if !isDateValid(versionContainer.Date) {
+		err := fmt.Errorf("invalid value '%s' for 'date'", versionContainer.Date)
+		toBadRequest(c, err)
+		return
+	}
+
+	versions, err := getRetainedWinVersions(c.Request.Context(), userId, versionContainer.Date)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+	var restored *winData
+	for _, version := range versions {
+		if version.Version == versionContainer.Version {
+			restored = &version.Win
+			break
+		}
+	}
+	if restored == nil {
+		toNotFound(c)
+		return
+	}
+
+	// make sure the client is not overwriting the entry modified from another device
+	err = dataStore.updateWin(c.Request.Context(), userId, versionContainer.Date, *restored, getIfMatchVersion(c))
+	if err == errConflict {
+		toWinVersionConflict(c, userId, versionContainer.Date)
+		return
+	}
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toWinSuccess(c, http.StatusOK, *restored)
+}
+
+// Versions are only pruned on update, so the old ones of the wins not updated since are filtered out here
+func getRetainedWinVersions(ctx context.Context, userId string, date string) ([]winVersionData, error) {
+	versions, err := dataStore.getWinVersions(ctx, userId, date, winHistoryMaxVersions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	retained := make([]winVersionData, 0, len(versions))
+	for _, version := range versions {
+		if isWinVersionExpired(version, now) {
+			continue
+		}
+		version.Win = normalizeWin(version.Win)
+		retained = append(retained, version)
+	}
+
+	return retained, nil
+}
+
+func isWinVersionExpired(version winVersionData, now time.Time) bool {
+	if winHistoryMaxAge <= 0 {
+		return false
+	}
+	replacedAt, err := time.Parse(TIMESTAMP_FORMAT, version.ReplacedAt)
+	if err != nil {
+		return false
+	}
+	return now.Sub(replacedAt) > winHistoryMaxAge
+}
+
+// Versions of the same date share the prefix
+func getWinVersionSortKey(date string, version string) string {
+	return fmt.Sprintf("%s#%s", date, version)
+}
@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWinUpdatesKeepPreviousVersions(t *testing.T) {
+	store := newHistoryStore(NewInMemoryStore())
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "First"}, "")
+	store.updateWin(ctx, "user", "20211001", winData{Text: "First"}, "")
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Second"}, "")
+	store.updateWins(ctx, "user", []winOnDayData{
+		{Date: "20211001", Win: winData{Text: "Third"}},
+		{Date: "20211005", Win: winData{Text: "New"}},
+	})
+	store.deleteWin(ctx, "user", "20211001", "")
+
+	versions, _ := store.getWinVersions(ctx, "user", "20211001", 100)
+
+	assert.Equal(t, 3, len(versions))
+	assert.Equal(t, "Third", versions[0].Win.Text)
+	assert.Equal(t, "Second", versions[1].Win.Text)
+	assert.Equal(t, "First", versions[2].Win.Text)
+	newVersions, _ := store.getWinVersions(ctx, "user", "20211005", 100)
+	assert.Equal(t, 0, len(newVersions))
+}
+
+func TestWinVersionsArePrunedByCount(t *testing.T) {
+	defer SetWinHistoryRetention(winHistoryMaxVersions, winHistoryMaxAge)
+	SetWinHistoryRetention(2, 0)
+	store := newHistoryStore(NewInMemoryStore())
+	ctx := context.Background()
+	for _, text := range []string{"First", "Second", "Third", "Fourth"} {
+		store.updateWin(ctx, "user", "20211001", winData{Text: text}, "")
+	}
+
+	versions, _ := store.getWinVersions(ctx, "user", "20211001", 100)
+
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, "Third", versions[0].Win.Text)
+	assert.Equal(t, "Second", versions[1].Win.Text)
+}
+
+// Serves the stale wins from the range reads, the way the cache does after another instance updated them
+type staleReadStore struct {
+	Store
+	stale []winOnDayData
+}
+
+func (s *staleReadStore) getWins(ctx context.Context, userId string, from string, to string) ([]winOnDayData, error) {
+	return s.stale, nil
+}
+
+func (s *staleReadStore) getWin(ctx context.Context, userId string, date string) (*winData, error) {
+	return &s.stale[0].Win, nil
+}
+
+func TestWinVersionsAreKeptFromStorageNotCache(t *testing.T) {
+	inner := NewInMemoryStore()
+	store := newHistoryStore(&staleReadStore{Store: inner, stale: []winOnDayData{{Date: "20211001", Win: winData{Text: "First"}}}})
+	ctx := context.Background()
+	inner.updateWin(ctx, "user", "20211001", winData{Text: "Second"}, "")
+
+	store.updateWins(ctx, "user", []winOnDayData{
+		{Date: "20211001", Win: winData{Text: "Third"}},
+		{Date: "20211031", Win: winData{Text: "New"}},
+	})
+
+	versions, _ := store.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "Second", versions[0].Win.Text)
+}
+
+func TestWinVersionsArePrunedInBoundedSteps(t *testing.T) {
+	defer SetWinHistoryRetention(winHistoryMaxVersions, winHistoryMaxAge)
+	SetWinHistoryRetention(1, 0)
+	inner := NewInMemoryStore()
+	store := newHistoryStore(inner)
+	ctx := context.Background()
+	versions := []winVersionData{}
+	for i := 0; i < 25; i++ {
+		versions = append(versions, winVersionData{Date: "20211001", Version: fmt.Sprintf("1%018d", i), Win: winData{Text: "Old"}})
+	}
+	inner.addWinVersions(ctx, "user", versions)
+	inner.updateWin(ctx, "user", "20211001", winData{Text: "Current"}, "")
+
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Updated"}, "")
+
+	left, _ := inner.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, 26-WIN_HISTORY_PRUNE_MAX_VERSIONS, len(left))
+	assert.Equal(t, "Current", left[0].Win.Text)
+}
+
+func TestExpiredWinVersionsAreNotListed(t *testing.T) {
+	defer SetWinHistoryRetention(winHistoryMaxVersions, winHistoryMaxAge)
+	SetWinHistoryRetention(10, time.Hour)
+	dataStore = NewInMemoryStore()
+	dataStore.addWinVersions(context.Background(), "user", []winVersionData{
+		{Date: "20211001", Version: "1", ReplacedAt: formatTimestamp(time.Now().Add(-2 * time.Hour)), Win: winData{Text: "Old"}},
+		{Date: "20211001", Version: "2", ReplacedAt: formatTimestamp(time.Now()), Win: winData{Text: "Recent"}},
+	})
+
+	versions, _ := getRetainedWinVersions(context.Background(), "user", "20211001")
+
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "Recent", versions[0].Win.Text)
+}
+
+func TestRestoreWinVersion(t *testing.T) {
+	dataStore = newHistoryStore(NewInMemoryStore())
+	ctx := context.Background()
+	dataStore.updateWin(ctx, "user", "20211001", winData{Text: "Long text", OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	dataStore.updateWin(ctx, "user", "20211001", winData{Text: "Overwritten"}, "")
+	versions, _ := dataStore.getWinVersions(ctx, "user", "20211001", 100)
+	params := gin.Params{{Key: "dt", Value: "20211001"}, {Key: "version", Value: versions[0].Version}}
+
+	code, win := callWinHandler(handlePostWinRestore, "POST", params, "")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Long text", win.Text)
+	stored, _ := dataStore.getWin(ctx, "user", "20211001")
+	assert.Equal(t, "Long text", stored.Text)
+	versions, _ = dataStore.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, "Overwritten", versions[0].Win.Text)
+}
+
+func TestRestoreMissingWinVersion(t *testing.T) {
+	dataStore = newHistoryStore(NewInMemoryStore())
+	params := gin.Params{{Key: "dt", Value: "20211001"}, {Key: "version", Value: "1"}}
+
+	code, _ := callWinHandler(handlePostWinRestore, "POST", params, "")
+
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRejectedWinUpdatesKeepNoVersions(t *testing.T) {
+	store := newHistoryStore(NewInMemoryStore())
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "First"}, "")
+	stale, _ := getStoredWinVersion(&winData{Text: "First"})
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Second"}, "")
+
+	for i := 0; i < 12; i++ {
+		err := store.updateWin(ctx, "user", "20211001", winData{Text: "Third"}, stale)
+		assert.Equal(t, errConflict, err)
+	}
+
+	versions, _ := store.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "First", versions[0].Win.Text)
+}
+
+// Fails all the updates of the single win
+type failingWinUpdateStore struct {
+	Store
+}
+
+func (s *failingWinUpdateStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	return errStorageUnavailable
+}
+
+func TestFailedWinUpdateKeepsNoVersion(t *testing.T) {
+	inner := NewInMemoryStore()
+	store := newHistoryStore(&failingWinUpdateStore{Store: inner})
+	ctx := context.Background()
+	inner.updateWin(ctx, "user", "20211001", winData{Text: "First"}, "")
+
+	err := store.updateWin(ctx, "user", "20211001", winData{Text: "Second"}, "")
+
+	assert.Equal(t, errStorageUnavailable, err)
+	versions, _ := store.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, 0, len(versions))
+}
+
+// Updates the win from another client right before the first update, the way the concurrent request would
+type racingWinUpdateStore struct {
+	Store
+	raced bool
+}
+
+func (s *racingWinUpdateStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	if !s.raced {
+		s.raced = true
+		s.Store.updateWin(ctx, userId, date, winData{Text: "Concurrent"}, "")
+	}
+	return s.Store.updateWin(ctx, userId, date, win, expectedVersion)
+}
+
+func TestWinVersionKeptIsTheOneReplaced(t *testing.T) {
+	inner := NewInMemoryStore()
+	store := newHistoryStore(&racingWinUpdateStore{Store: inner})
+	ctx := context.Background()
+	inner.updateWin(ctx, "user", "20211001", winData{Text: "First"}, "")
+
+	err := store.updateWin(ctx, "user", "20211001", winData{Text: "Second"}, "")
+
+	assert.Nil(t, err)
+	versions, _ := store.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "Concurrent", versions[0].Win.Text)
+}
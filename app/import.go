@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IMPORT_MODE_MERGE   = "merge"
+	IMPORT_MODE_REPLACE = "replace"
+)
+
+type importOptionsData struct {
+	Mode   string `form:"mode"`
+	DryRun bool   `form:"dryRun"`
+}
+
+type importReportData struct {
+	Mode               string               `json:"mode"`
+	DryRun             bool                 `json:"dryRun"`
+	AcceptedWins       int                  `json:"acceptedWins"`
+	AcceptedPriorities int                  `json:"acceptedPriorities"`
+	Rejected           []importRejectedData `json:"rejected"`
+}
+
+// Points to the rejected row of the imported document, so the user can fix it and re-import
+type importRejectedData struct {
+	Section string `json:"section"`
+	Index   int    `json:"index"`
+	Key     string `json:"key"`
+	Err     string `json:"err"`
+}
+
+func handlePostImport(c *gin.Context, userId string, email string) {
+	// get options from the query string
+	var options importOptionsData
+	if err := c.ShouldBindQuery(&options); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+	if options.Mode == "" {
+		options.Mode = IMPORT_MODE_MERGE
+	}
+
+	// sanitize
+	if options.Mode != IMPORT_MODE_MERGE && options.Mode != IMPORT_MODE_REPLACE {
+		err := fmt.Errorf("invalid value '%s' for 'mode', should be '%s' or '%s'",
+			options.Mode,
+			IMPORT_MODE_MERGE,
+			IMPORT_MODE_REPLACE)
+		toBadRequest(c, err)
+		return
+	}
+
+	// get the exported document from the POST body
+	var data exportData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// the incomplete export would make the replace delete the wins that are missing from it
+	if data.Error != "" {
+		err := fmt.Errorf("the document is an incomplete export: %s", data.Error)
+		toBadRequest(c, err)
+		return
+	}
+
+	report := importReportData{
+		Mode:     options.Mode,
+		DryRun:   options.DryRun,
+		Rejected: []importRejectedData{},
+	}
+
+	// invalid rows are skipped and reported, the rest is imported
+	priorities := getPrioritiesToImport(data.Priorities, &report)
+	wins := getWinsToImport(data.Wins, &report)
+
+	// in merge mode, imported priorities are added to the existing ones, replacing those with the same id
+	if options.Mode == IMPORT_MODE_MERGE {
+		existing, _, err := dataStore.getPriorities(c.Request.Context(), userId)
+		if err != nil {
+			toStorageError(c, err)
+			return
+		}
+		if existing != nil {
+			priorities = mergePriorities(existing.Items, priorities)
+		}
+	}
+
+	// the resulting list is saved as a whole, so it cannot be partially accepted
+	if err := validatePriorities(priorityListData{Items: priorities}); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	report.AcceptedWins = len(wins)
+	report.AcceptedPriorities = len(priorities)
+	if options.DryRun {
+		toSuccess(c, report)
+		return
+	}
+
+	if options.Mode == IMPORT_MODE_REPLACE {
+		err := deleteWinsMissingFromImport(c.Request.Context(), userId, wins)
+		if err != nil {
+			toStorageError(c, err)
+			return
+		}
+	}
+
+	_, err := dataStore.updateWins(c.Request.Context(), userId, wins)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	if len(priorities) > 0 {
+		err = dataStore.updatePriorities(c.Request.Context(), userId, priorityListData{Items: priorities}, generateTimestamp(), "")
+	} else if options.Mode == IMPORT_MODE_REPLACE {
+		err = dataStore.deletePriorities(c.Request.Context(), userId)
+	}
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toSuccess(c, report)
+}
+
+// Deletes the wins one by one rather than all at once, so the deletions leave tombstones and are synced to other devices
+// The wins on the imported dates are overwritten anyway
+func deleteWinsMissingFromImport(ctx context.Context, userId string, wins []winOnDayData) error {
+	imported := map[string]bool{}
+	for _, winOnDay := range wins {
+		imported[winOnDay.Date] = true
+	}
+
+	missing := []string{}
+	err := dataStore.forEachWin(ctx, userId, func(winOnDay winOnDayData) error {
+		if !imported[winOnDay.Date] {
+			missing = append(missing, winOnDay.Date)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, date := range missing {
+		err = dataStore.deleteWin(ctx, userId, date, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getPrioritiesToImport(priorities []priorityData, report *importReportData) []priorityData {
+	accepted := make([]priorityData, 0, len(priorities))
+	seen := map[string]bool{}
+	for i, p := range priorities {
+		err := validatePriority(p)
+		if err == nil && seen[p.Id] {
+			err = fmt.Errorf("duplicate id '%s'", p.Id)
+		}
+		if err != nil {
+			report.Rejected = append(report.Rejected, importRejectedData{
+				Section: "priorities",
+				Index:   i,
+				Key:     p.Id,
+				Err:     err.Error(),
+			})
+			continue
+		}
+
+		seen[p.Id] = true
+		accepted = append(accepted, p)
+	}
+	return accepted
+}
+
+func getWinsToImport(wins []winOnDayData, report *importReportData) []winOnDayData {
+	accepted := make([]winOnDayData, 0, len(wins))
+	seen := map[string]bool{}
+	createdAt := generateTimestamp()
+	for i, winOnDay := range wins {
+		winOnDay.Win = prepareWinEntries(winOnDay.Win, createdAt)
+		err := validateWin(winOnDay.Date, winOnDay.Win)
+		if err == nil && seen[winOnDay.Date] {
+			err = fmt.Errorf("duplicate date '%s'", winOnDay.Date)
+		}
+		if err != nil {
+			report.Rejected = append(report.Rejected, importRejectedData{
+				Section: "wins",
+				Index:   i,
+				Key:     winOnDay.Date,
+				Err:     err.Error(),
+			})
+			continue
+		}
+
+		seen[winOnDay.Date] = true
+		accepted = append(accepted, winOnDay)
+	}
+	return accepted
+}
+
+// Keeps the order of the existing priorities, new ones are appended at the end
+func mergePriorities(existing []priorityData, imported []priorityData) []priorityData {
+	importedById := map[string]priorityData{}
+	for _, p := range imported {
+		importedById[p.Id] = p
+	}
+
+	merged := make([]priorityData, 0, len(existing)+len(imported))
+	for _, p := range existing {
+		if replacement, ok := importedById[p.Id]; ok {
+			merged = append(merged, replacement)
+			delete(importedById, p.Id)
+		} else {
+			merged = append(merged, p)
+		}
+	}
+	for _, p := range imported {
+		if _, ok := importedById[p.Id]; ok {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
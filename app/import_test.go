@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const importTestDocument = `{
+	"priorities": [{"id": "002", "text": "Work", "color": 2}],
+	"wins": [
+		{"date": "20211003", "win": {"text": "Shipped", "overall": 1, "priorities": ["002"]}},
+		{"date": "2021-10-04", "win": {"text": "Bad date", "overall": 1}},
+		{"date": "20211005", "win": {"text": "Bad overall", "overall": 7}},
+		{"date": "20211003", "win": {"text": "Duplicate", "overall": 2}}
+	]
+}`
+
+func postImport(query string, body string) (int, importReportData) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/import"+query, strings.NewReader(body))
+
+	handlePostImport(c, "user", "user@example.com")
+
+	var response struct {
+		Data importReportData `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.Data
+}
+
+func TestImportMerge(t *testing.T) {
+	setupExportTestData()
+	ctx := context.Background()
+
+	code, report := postImport("", importTestDocument)
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, IMPORT_MODE_MERGE, report.Mode)
+	assert.Equal(t, 1, report.AcceptedWins)
+	assert.Equal(t, 2, report.AcceptedPriorities)
+	assert.Equal(t, 3, len(report.Rejected))
+	assert.Equal(t, 1, report.Rejected[0].Index)
+	assert.Equal(t, 2, report.Rejected[1].Index)
+	assert.Equal(t, 3, report.Rejected[2].Index)
+
+	wins, _ := dataStore.getWins(ctx, "user", "20211001", "20211005")
+	assert.Equal(t, 3, len(wins))
+	assert.Equal(t, "Shipped", wins[2].Win.Text)
+	priorities, _, _ := dataStore.getPriorities(ctx, "user")
+	assert.Equal(t, 2, len(priorities.Items))
+	assert.Equal(t, "001", priorities.Items[0].Id)
+	assert.Equal(t, "002", priorities.Items[1].Id)
+}
+
+func TestImportReplace(t *testing.T) {
+	setupExportTestData()
+	ctx := context.Background()
+
+	code, report := postImport("?mode=replace", importTestDocument)
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 1, report.AcceptedWins)
+	wins, _ := dataStore.getWins(ctx, "user", "20211001", "20211005")
+	assert.Equal(t, 1, len(wins))
+	assert.Equal(t, "20211003", wins[0].Date)
+	priorities, _, _ := dataStore.getPriorities(ctx, "user")
+	assert.Equal(t, 1, len(priorities.Items))
+	assert.Equal(t, "002", priorities.Items[0].Id)
+
+	// the deleted wins are synced
+	changes, _ := dataStore.getWinChanges(ctx, "user", "")
+	deleted := []string{}
+	for _, change := range changes {
+		if change.Deleted {
+			deleted = append(deleted, change.Date)
+		}
+	}
+	assert.Equal(t, 2, len(deleted))
+	assert.NotContains(t, deleted, "20211003")
+}
+
+func TestImportDryRun(t *testing.T) {
+	setupExportTestData()
+	ctx := context.Background()
+
+	code, report := postImport("?mode=replace&dryRun=true", importTestDocument)
+
+	assert.Equal(t, 200, code)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.AcceptedWins)
+	wins, _ := dataStore.getWins(ctx, "user", "20211001", "20211005")
+	assert.Equal(t, 2, len(wins))
+}
+
+func TestImportExportRoundtrip(t *testing.T) {
+	setupExportTestData()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/export", nil)
+	handleGetExport(c, "user", "user@example.com")
+	exported := w.Body.String()
+
+	code, report := postImport("?mode=replace", exported)
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 2, report.AcceptedWins)
+	assert.Equal(t, 0, len(report.Rejected))
+}
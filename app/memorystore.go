@@ -0,0 +1,495 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+type inMemoryStore struct {
+	lock       sync.RWMutex
+	wins       map[string]map[string]inMemoryWin
+	deleted    map[string]map[string]string
+	versions   map[string]map[string][]winVersionData
+	priorities map[string]inMemoryPriorityList
+	deletions  map[string]deletionRequestData
+}
+
+type inMemoryWin struct {
+	win       winData
+	updatedAt string
+}
+
+type inMemoryPriorityList struct {
+	items     []priorityData
+	updatedAt string
+}
+
+func NewInMemoryStore() Store {
+	return &inMemoryStore{
+		wins:       map[string]map[string]inMemoryWin{},
+		deleted:    map[string]map[string]string{},
+		versions:   map[string]map[string][]winVersionData{},
+		priorities: map[string]inMemoryPriorityList{},
+		deletions:  map[string]deletionRequestData{},
+	}
+}
+
+func (s *inMemoryStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	winsByDate, ok := s.wins[userId]
+	if !ok {
+		winsByDate = map[string]inMemoryWin{}
+		s.wins[userId] = winsByDate
+	}
+	if err := checkStoredWinVersion(s.getStoredWin(userId, date), expectedVersion); err != nil {
+		return err
+	}
+	winsByDate[date] = inMemoryWin{
+		win:       copyWin(win),
+		updatedAt: generateTimestamp(),
+	}
+
+	return nil
+}
+
+func (s *inMemoryStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	written := make([]string, 0, len(wins))
+	for _, winOnDay := range wins {
+		err := s.updateWin(ctx, userId, winOnDay.Date, winOnDay.Win, "")
+		if err != nil {
+			return written, err
+		}
+		written = append(written, winOnDay.Date)
+	}
+
+	return written, nil
+}
+
+func (s *inMemoryStore) patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	winsByDate, ok := s.wins[userId]
+	if !ok {
+		winsByDate = map[string]inMemoryWin{}
+		s.wins[userId] = winsByDate
+	}
+	if err := checkStoredWinVersion(s.getStoredWin(userId, date), expectedVersion); err != nil {
+		return nil, err
+	}
+	win := winData{Priorities: []string{}}
+	if stored, ok := winsByDate[date]; ok {
+		win = stored.win
+	}
+
+	patched, err := applyWinPatch(win, patch)
+	if err != nil {
+		return nil, err
+	}
+	winsByDate[date] = inMemoryWin{
+		win:       copyWin(patched),
+		updatedAt: generateTimestamp(),
+	}
+
+	return &patched, nil
+}
+
+func (s *inMemoryStore) getWin(ctx context.Context, userId string, date string) (*winData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stored, ok := s.wins[userId][date]
+	if !ok {
+		return nil, nil
+	}
+
+	result := copyWin(stored.win)
+	return &result, nil
+}
+
+// expects the lock to be held by the caller
+func (s *inMemoryStore) getStoredWin(userId string, date string) *winData {
+	stored, ok := s.wins[userId][date]
+	if !ok {
+		return nil
+	}
+	return &stored.win
+}
+
+func (s *inMemoryStore) getWinsOnDates(ctx context.Context, userId string, dates []string) ([]winOnDayData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	wins := make([]winOnDayData, 0, len(dates))
+	for _, date := range dates {
+		if stored, ok := s.wins[userId][date]; ok {
+			wins = append(wins, winOnDayData{
+				Date: date,
+				Win:  copyWin(stored.win),
+			})
+		}
+	}
+
+	return wins, nil
+}
+
+func (s *inMemoryStore) deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := checkStoredWinVersion(s.getStoredWin(userId, date), expectedVersion); err != nil {
+		return err
+	}
+	if _, ok := s.wins[userId][date]; !ok {
+		return nil
+	}
+	delete(s.wins[userId], date)
+
+	deletedByDate, ok := s.deleted[userId]
+	if !ok {
+		deletedByDate = map[string]string{}
+		s.deleted[userId] = deletedByDate
+	}
+	deletedByDate[date] = generateTimestamp()
+
+	return nil
+}
+
+func (s *inMemoryStore) getWins(ctx context.Context, userId string, from string, to string) ([]winOnDayData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	dates := s.getDatesInInterval(userId, from, to)
+	wins := make([]winOnDayData, len(dates))
+	for i, date := range dates {
+		wins[i] = winOnDayData{
+			Date: date,
+			Win:  copyWin(s.wins[userId][date].win),
+		}
+	}
+
+	return wins, nil
+}
+
+func (s *inMemoryStore) getWinDays(ctx context.Context, userId string, from string, to string) ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	dates := s.getDatesInInterval(userId, from, to)
+	days := make([]string, 0, len(dates))
+	for _, date := range dates {
+		overallResult := s.wins[userId][date].win.OverallResult
+		if overallResult == OVERALL_DAY_RESULT_GOT_MY_WIN ||
+			overallResult == OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT {
+			days = append(days, date)
+		}
+	}
+
+	return days, nil
+}
+
+func (s *inMemoryStore) getWinDayStats(ctx context.Context, userId string, from string, to string) ([]winOnDayShortData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	dates := s.getDatesInInterval(userId, from, to)
+	wins := make([]winOnDayShortData, len(dates))
+	for i, date := range dates {
+		win := copyWin(s.wins[userId][date].win)
+		wins[i] = winOnDayShortData{
+			Date: date,
+			Win: winShortData{
+				OverallResult: win.OverallResult,
+				Priorities:    win.Priorities,
+				Tags:          win.Tags,
+			},
+		}
+	}
+
+	return wins, nil
+}
+
+func (s *inMemoryStore) updatePriorities(ctx context.Context, userId string, priorities priorityListData, updatedAt string, expectedVersion string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if expectedVersion != "" && s.priorities[userId].updatedAt != expectedVersion {
+		return errConflict
+	}
+
+	// keep the same limits as the real storage
+	s.priorities[userId] = inMemoryPriorityList{
+		items:     encodePriorities(priorities.Items, 100),
+		updatedAt: updatedAt,
+	}
+
+	return nil
+}
+
+func (s *inMemoryStore) getPriorities(ctx context.Context, userId string) (*priorityListData, string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stored, ok := s.priorities[userId]
+	if !ok {
+		return nil, "", nil
+	}
+
+	decoded, err := decodePriorities(stored.items)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &priorityListData{
+		Items: decoded,
+	}, stored.updatedAt, nil
+}
+
+func (s *inMemoryStore) getWinChanges(ctx context.Context, userId string, since string) ([]winChangeData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	changes := make([]winChangeData, 0)
+	for date, stored := range s.wins[userId] {
+		if stored.updatedAt > since {
+			win := copyWin(stored.win)
+			changes = append(changes, winChangeData{
+				Date:      date,
+				Win:       &win,
+				UpdatedAt: stored.updatedAt,
+			})
+		}
+	}
+	for date, deletedAt := range s.deleted[userId] {
+		if deletedAt > since {
+			changes = append(changes, winChangeData{
+				Date:      date,
+				Deleted:   true,
+				UpdatedAt: deletedAt,
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *inMemoryStore) addWinVersions(ctx context.Context, userId string, versions []winVersionData) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	versionsByDate, ok := s.versions[userId]
+	if !ok {
+		versionsByDate = map[string][]winVersionData{}
+		s.versions[userId] = versionsByDate
+	}
+	for _, version := range versions {
+		version.Win = copyWin(version.Win)
+		versionsByDate[version.Date] = append(versionsByDate[version.Date], version)
+	}
+
+	return nil
+}
+
+func (s *inMemoryStore) getWinVersions(ctx context.Context, userId string, date string, limit int) ([]winVersionData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stored := s.versions[userId][date]
+	versions := make([]winVersionData, 0, len(stored))
+	for _, version := range stored {
+		version.Win = copyWin(version.Win)
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+	if len(versions) > limit {
+		versions = versions[:limit]
+	}
+
+	return versions, nil
+}
+
+func (s *inMemoryStore) deleteWinVersions(ctx context.Context, userId string, date string, versions []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stored := s.versions[userId][date]
+	kept := make([]winVersionData, 0, len(stored))
+	for _, version := range stored {
+		if !containsString(versions, version.Version) {
+			kept = append(kept, version)
+		}
+	}
+	if len(stored) > 0 {
+		s.versions[userId][date] = kept
+	}
+
+	return nil
+}
+
+func (s *inMemoryStore) forEachWin(ctx context.Context, userId string, callback func(winOnDayData) error) error {
+	s.lock.RLock()
+	wins := make([]winOnDayData, 0, len(s.wins[userId]))
+	for _, date := range s.getDatesInInterval(userId, "", "99999999") {
+		wins = append(wins, winOnDayData{
+			Date: date,
+			Win:  copyWin(s.wins[userId][date].win),
+		})
+	}
+	s.lock.RUnlock()
+
+	// callback is called without holding the lock, so it can use the store
+	for _, win := range wins {
+		err := callback(win)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *inMemoryStore) deleteAllWins(ctx context.Context, userId string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.wins, userId)
+	delete(s.deleted, userId)
+	delete(s.versions, userId)
+
+	return nil
+}
+
+func (s *inMemoryStore) deletePriorities(ctx context.Context, userId string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.priorities, userId)
+
+	return nil
+}
+
+func (s *inMemoryStore) saveDeletionRequest(ctx context.Context, userId string, request deletionRequestData, expected *deletionRequestData) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkDeletionRequest(userId, expected); err != nil {
+		return err
+	}
+	request.UserId = userId
+	s.deletions[userId] = request
+
+	return nil
+}
+
+func (s *inMemoryStore) getDeletionRequest(ctx context.Context, userId string) (*deletionRequestData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	request, ok := s.deletions[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &request, nil
+}
+
+func (s *inMemoryStore) getDueDeletionRequests(ctx context.Context, now string) ([]deletionRequestData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	requests := make([]deletionRequestData, 0)
+	for _, request := range s.deletions {
+		if request.PurgeAt != "" && request.PurgeAt <= now {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests, nil
+}
+
+func (s *inMemoryStore) deleteDeletionRequest(ctx context.Context, userId string, expected *deletionRequestData) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkDeletionRequest(userId, expected); err != nil {
+		return err
+	}
+	delete(s.deletions, userId)
+
+	return nil
+}
+
+// expects the lock to be held by the caller
+func (s *inMemoryStore) checkDeletionRequest(userId string, expected *deletionRequestData) error {
+	if expected == nil {
+		return nil
+	}
+	stored, ok := s.deletions[userId]
+	if !ok || !isSameDeletionRequest(stored, *expected) {
+		return errConflict
+	}
+	return nil
+}
+
+// returns dates [from:to] in ascending order, the same way DynamoDB sorts them
+// expects the lock to be held by the caller
+func (s *inMemoryStore) getDatesInInterval(userId string, from string, to string) []string {
+	dates := make([]string, 0)
+	for date := range s.wins[userId] {
+		if date >= from && date <= to {
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+func copyWin(win winData) winData {
+	var priorities []string
+	if win.Priorities != nil {
+		priorities = make([]string, len(win.Priorities))
+		copy(priorities, win.Priorities)
+	}
+
+	var entries []winEntryData
+	if win.Entries != nil {
+		entries = make([]winEntryData, len(win.Entries))
+		for i, e := range win.Entries {
+			entries[i] = copyWinEntry(e)
+		}
+	}
+
+	var tags []string
+	if win.Tags != nil {
+		tags = make([]string, len(win.Tags))
+		copy(tags, win.Tags)
+	}
+
+	return winData{
+		Text:          win.Text,
+		OverallResult: win.OverallResult,
+		Priorities:    priorities,
+		Entries:       entries,
+		Tags:          tags,
+	}
+}
+
+func copyWinEntry(entry winEntryData) winEntryData {
+	var priorities []string
+	if entry.Priorities != nil {
+		priorities = make([]string, len(entry.Priorities))
+		copy(priorities, entry.Priorities)
+	}
+
+	return winEntryData{
+		Id:         entry.Id,
+		Text:       entry.Text,
+		Priorities: priorities,
+		CreatedAt:  entry.CreatedAt,
+	}
+}
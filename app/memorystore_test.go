@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryStoreWinRoundtrip(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+	win := winData{
+		Text:          "Some text",
+		OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN,
+		Priorities:    []string{"001", "002"},
+	}
+
+	store.updateWin(ctx, "user", "20211001", win, "")
+	storedWin, _ := store.getWin(ctx, "user", "20211001")
+
+	assert.True(t, reflect.DeepEqual(*storedWin, win))
+}
+
+func TestInMemoryStoreMissingWin(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+
+	storedWin, err := store.getWin(ctx, "user", "20211001")
+
+	assert.Nil(t, err)
+	assert.Nil(t, storedWin)
+}
+
+func TestInMemoryStoreGetWinsInInterval(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211003", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	store.updateWin(ctx, "user", "20211001", winData{OverallResult: OVERALL_DAY_RESULT_COULD_NOT_GET_MY_WIN}, "")
+	store.updateWin(ctx, "user", "20211002", winData{OverallResult: OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT}, "")
+	store.updateWin(ctx, "user", "20211010", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	store.updateWin(ctx, "another user", "20211002", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+
+	wins, _ := store.getWins(ctx, "user", "20211001", "20211003")
+	assert.Equal(t, 3, len(wins))
+	assert.Equal(t, "20211001", wins[0].Date)
+	assert.Equal(t, "20211002", wins[1].Date)
+	assert.Equal(t, "20211003", wins[2].Date)
+
+	days, _ := store.getWinDays(ctx, "user", "20211001", "20211003")
+	assert.True(t, reflect.DeepEqual(days, []string{"20211002", "20211003"}))
+}
+
+func TestInMemoryStoreDeleteAllData(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Some text"}, "")
+	store.updatePriorities(ctx, "user", priorityListData{Items: []priorityData{{Id: "001", Text: "One"}}}, generateTimestamp(), "")
+
+	store.deleteAllWins(ctx, "user")
+	store.deletePriorities(ctx, "user")
+
+	wins, _ := store.getWins(ctx, "user", "20210101", "20211231")
+	priorities, _, _ := store.getPriorities(ctx, "user")
+	assert.Equal(t, 0, len(wins))
+	assert.Nil(t, priorities)
+}
+
+func TestInMemoryStoreUpdatePrioritiesWithStaleVersion(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+	priorities := priorityListData{Items: []priorityData{{Id: "001", Text: "One"}}}
+	store.updatePriorities(ctx, "user", priorities, "v1", "")
+	store.updatePriorities(ctx, "user", priorities, "v2", "v1")
+
+	err := store.updatePriorities(ctx, "user", priorities, "v3", "v1")
+
+	assert.Equal(t, errConflict, err)
+	_, version, _ := store.getPriorities(ctx, "user")
+	assert.Equal(t, "v2", version)
+}
+
+func TestInMemoryStoreGetWinChanges(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Old"}, "")
+	store.updateWin(ctx, "user", "20211002", winData{Text: "Deleted"}, "")
+	since := generateTimestamp()
+	store.updateWin(ctx, "user", "20211003", winData{Text: "New"}, "")
+	store.deleteWin(ctx, "user", "20211002", "")
+
+	changes := getLatestWinChanges(mustGetWinChanges(t, store, since))
+
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, "20211003", changes[0].Date)
+	assert.Equal(t, "New", changes[0].Win.Text)
+	assert.Equal(t, "20211002", changes[1].Date)
+	assert.True(t, changes[1].Deleted)
+}
+
+func mustGetWinChanges(t *testing.T, store Store, since string) []winChangeData {
+	changes, err := store.getWinChanges(context.Background(), "user", since)
+	if err != nil {
+		t.Fatalf("Error getting changes: %s", err)
+	}
+	return changes
+}
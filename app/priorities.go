@@ -25,9 +25,9 @@ func handleGetPriorities(c *gin.Context, userId string, email string) {
 	//toBadRequest(c, fmt.Errorf("Something went wrong returning priorities"))
 	//return
 
-	priorityList, err := getPriorities(userId)
+	priorityList, version, err := dataStore.getPriorities(c.Request.Context(), userId)
 	if err != nil {
-		toInternalServerError(c, err.Error())
+		toStorageError(c, err)
 		return
 	}
 
@@ -37,6 +37,7 @@ func handleGetPriorities(c *gin.Context, userId string, email string) {
 		}
 	}
 
+	setETag(c, version)
 	toSuccess(c, priorityList)
 }
 
@@ -49,43 +50,78 @@ func handlePostPriorities(c *gin.Context, userId string, email string) {
 	}
 
 	// sanitize
-	if !isPriorityListLengthValid(priorities) {
-		err := fmt.Errorf("too many items in a priority list, max %d active and %d total allowed",
-			PRIORITIES_ACTIVE_MAX_TOTAL,
-			PRIORITIES_MAX_TOTAL)
+	if err := validatePriorities(priorities); err != nil {
 		toBadRequest(c, err)
 		return
 	}
-	for _, p := range priorities.Items {
-		if !isPriorityIdValid(p.Id) {
-			err := fmt.Errorf("invalid id, should not be empty and less than %d characters long",
-				PRIORITY_ID_MAX_LENGTH)
-			toBadRequest(c, err)
-			return
-		}
-		if !isPriorityTextValid(p.Text) {
-			err := fmt.Errorf("invalid value '%s' for 'text', should be less than %d characters long",
-				p.Text,
-				PRIORITY_TEXT_MAX_LENGTH)
-			toBadRequest(c, err)
-			return
-		}
-		if !isPriorityColorValid(p.Color) {
-			err := fmt.Errorf("invalid value '%d' for 'color', should be a number 0 <= x < 100", p.Color)
-			toBadRequest(c, err)
-			return
-		}
-	}
+
+	// the version the client has seen, to make sure it does not overwrite changes made from another device
+	expectedVersion := getIfMatchVersion(c)
 
 	updatedAt := generateTimestamp()
-	err := updatePriorities(userId, priorities, updatedAt)
+	err := dataStore.updatePriorities(c.Request.Context(), userId, priorities, updatedAt, expectedVersion)
+	if err == errConflict {
+		handlePrioritiesConflict(c, userId)
+		return
+	}
 	if err != nil {
-		toInternalServerError(c, err.Error())
+		toStorageError(c, err)
 		return
 	}
 
 	/*toBadRequest(c, fmt.Errorf("Something went wrong saving priorities"))
 	return*/
 
+	setETag(c, updatedAt)
 	toSuccess(c, priorities)
 }
+
+func validatePriorities(priorities priorityListData) error {
+	if !isPriorityListLengthValid(priorities) {
+		return fmt.Errorf("too many items in a priority list, max %d active and %d total allowed",
+			PRIORITIES_ACTIVE_MAX_TOTAL,
+			PRIORITIES_MAX_TOTAL)
+	}
+	for _, p := range priorities.Items {
+		if err := validatePriority(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validatePriority(p priorityData) error {
+	if !isPriorityIdValid(p.Id) {
+		return fmt.Errorf("invalid id, should not be empty and less than %d characters long",
+			PRIORITY_ID_MAX_LENGTH)
+	}
+	if !isPriorityTextValid(p.Text) {
+		return fmt.Errorf("invalid value '%s' for 'text', should be less than %d characters long",
+			p.Text,
+			PRIORITY_TEXT_MAX_LENGTH)
+	}
+	if !isPriorityColorValid(p.Color) {
+		return fmt.Errorf("invalid value '%d' for 'color', should be a number 0 <= x < 100", p.Color)
+	}
+
+	return nil
+}
+
+// Returns the current server copy, so the client can merge the changes and retry
+func handlePrioritiesConflict(c *gin.Context, userId string) {
+	priorityList, version, err := dataStore.getPriorities(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	if priorityList == nil {
+		priorityList = &priorityListData{
+			Items: []priorityData{},
+		}
+	}
+
+	setETag(c, version)
+	toConflict(c, errConflict.Error(), priorityList)
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"artemkv.net/winaday/reststats"
+	"github.com/gin-gonic/gin"
+)
+
+var RATE_LIMITER_CLEANUP_INTERVAL = time.Duration(1) * time.Minute
+
+// X-Forwarded-For is only believed when the request comes from one of these, anyone could send it otherwise
+var trustedProxies []*net.IPNet
+
+type RateLimit struct {
+	// 0 disables the limit
+	RequestsPerMinute int
+	// how many requests can be made at once, after a period of inactivity
+	Burst int
+}
+
+type RateLimitConfiguration struct {
+	// sign-in, by client IP
+	SignIn RateLimit
+	// other unauthenticated routes, by client IP
+	Public RateLimit
+	// authenticated routes, by user id
+	User RateLimit
+}
+
+// Token bucket per key
+type rateLimiter struct {
+	lock        sync.Mutex
+	rate        float64 // tokens per second
+	burst       float64
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:        float64(limit.RequestsPerMinute) / 60.0,
+		burst:       float64(burst),
+		buckets:     map[string]*tokenBucket{},
+		lastCleanup: time.Now(),
+	}
+}
+
+// Takes a token from the key's bucket
+// When there are no tokens left, returns false and how long to wait for the next token
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.cleanup(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens:  l.burst,
+			updated: now,
+		}
+		l.buckets[key] = bucket
+	}
+
+	l.refill(bucket, now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// expects the lock to be held by the caller
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.updated).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+		bucket.updated = now
+	}
+}
+
+// Drops full buckets, they are no different from the new ones
+// expects the lock to be held by the caller
+func (l *rateLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < RATE_LIMITER_CLEANUP_INTERVAL {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Accepts IP addresses and CIDR ranges, empty list means the server is reached directly
+func SetTrustedProxies(proxies []string) error {
+	parsed := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return &net.ParseError{Type: "IP address", Text: proxy}
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, cidr)
+	}
+
+	trustedProxies = parsed
+	return nil
+}
+
+// Limits requests by client IP
+func rateLimitByIp(limit RateLimit) gin.HandlerFunc {
+	if limit.RequestsPerMinute <= 0 {
+		return func(c *gin.Context) {}
+	}
+
+	limiter := newRateLimiter(limit)
+	return func(c *gin.Context) {
+		applyRateLimit(c, limiter, "ip#"+getClientIp(c))
+	}
+}
+
+// Limits requests by user id, falls back to client IP when the session is not valid
+func rateLimitByUser(limit RateLimit) gin.HandlerFunc {
+	if limit.RequestsPerMinute <= 0 {
+		return func(c *gin.Context) {}
+	}
+
+	limiter := newRateLimiter(limit)
+	return func(c *gin.Context) {
+		key := "ip#" + getClientIp(c)
+		if session, err := getSession(c); err == nil {
+			key = "user#" + session.UserId
+		}
+		applyRateLimit(c, limiter, key)
+	}
+}
+
+// The address the request came from, unless it came through a trusted proxy
+// Each proxy appends the address it got the request from to X-Forwarded-For, so the header is read from the end,
+// the first address that is not a trusted proxy is the client, everything before it could be made up by the client
+func getClientIp(c *gin.Context) string {
+	remoteIp, _ := c.RemoteIP()
+	if remoteIp == nil {
+		return ""
+	}
+	if !isTrustedProxy(remoteIp) {
+		return remoteIp.String()
+	}
+
+	clientIp := remoteIp
+	forwardedFor := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwardedFor[i]))
+		if ip == nil {
+			break
+		}
+		clientIp = ip
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+	return clientIp.String()
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, cidr := range trustedProxies {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyRateLimit(c *gin.Context, limiter *rateLimiter, key string) {
+	start := time.Now()
+	allowed, wait := limiter.allow(key, start)
+	if allowed {
+		return
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"err": "Too many requests"})
+
+	reststats.UpdateResponseStatsOnThrottle(start, c.Request.RequestURI)
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterAllowsBurst(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RequestsPerMinute: 60, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.allow("user", now)
+		assert.True(t, allowed)
+	}
+	allowed, wait := limiter.allow("user", now)
+
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, wait)
+}
+
+func TestRateLimiterRefillsOverTime(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RequestsPerMinute: 60, Burst: 1})
+	now := time.Now()
+
+	allowed, _ := limiter.allow("user", now)
+	assert.True(t, allowed)
+	allowed, _ = limiter.allow("user", now.Add(500*time.Millisecond))
+	assert.False(t, allowed)
+	allowed, _ = limiter.allow("user", now.Add(1000*time.Millisecond))
+	assert.True(t, allowed)
+}
+
+func TestRateLimiterKeepsKeysSeparate(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RequestsPerMinute: 60, Burst: 1})
+	now := time.Now()
+
+	allowed, _ := limiter.allow("user", now)
+	assert.True(t, allowed)
+	allowed, _ = limiter.allow("another user", now)
+	assert.True(t, allowed)
+}
+
+func getTestClientIp(remoteAddr string, forwardedFor string) string {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/signin", nil)
+	c.Request.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		c.Request.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	return getClientIp(c)
+}
+
+func TestClientIpIgnoresForwardedForWithoutTrustedProxies(t *testing.T) {
+	SetTrustedProxies(nil)
+
+	assert.Equal(t, "203.0.113.7", getTestClientIp("203.0.113.7:1234", "198.51.100.1"))
+}
+
+func TestClientIpBehindTrustedProxy(t *testing.T) {
+	err := SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		SetTrustedProxies(nil)
+	})
+
+	// the client can only make up the addresses before its own
+	assert.Equal(t, "203.0.113.7", getTestClientIp("10.0.0.5:1234", "198.51.100.1, 203.0.113.7"))
+	assert.Equal(t, "203.0.113.7", getTestClientIp("10.0.0.5:1234", "203.0.113.7, 192.168.1.1"))
+	assert.Equal(t, "10.0.0.5", getTestClientIp("10.0.0.5:1234", ""))
+	// not coming through the proxy
+	assert.Equal(t, "203.0.113.8", getTestClientIp("203.0.113.8:1234", "198.51.100.1"))
+}
+
+func TestSetTrustedProxiesRejectsInvalidAddress(t *testing.T) {
+	assert.NotNil(t, SetTrustedProxies([]string{"proxy"}))
+	SetTrustedProxies(nil)
+}
@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// 1 attempt disables the retries, jitter is the part of the delay that is randomized, between 0 and 1
+var storageRetryMaxAttempts = 3
+var storageRetryBaseDelay = time.Duration(50) * time.Millisecond
+var storageRetryJitter = 0.5
+
+// Error codes DynamoDB returns when the request rate is too high, the request can succeed a bit later
+var throttlingErrorCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+	"TransactionInProgressException":         true,
+}
+
+// The subset of the DynamoDB client used by the store, satisfies the paginators as well
+type dynamoDbClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// Retries every call that failed with the retryable error, waiting longer after each attempt
+// The deadline of the caller covers all the attempts, so the retries never make the request slower than the storage timeout
+type retryingDynamoDbClient struct {
+	client  dynamoDbClient
+	onRetry func(operation string)
+}
+
+func SetStorageRetryPolicy(maxAttempts int, baseDelay time.Duration, jitter float64) {
+	storageRetryMaxAttempts = maxAttempts
+	storageRetryBaseDelay = baseDelay
+	storageRetryJitter = jitter
+}
+
+func newRetryingDynamoDbClient(client dynamoDbClient, onRetry func(operation string)) dynamoDbClient {
+	return &retryingDynamoDbClient{
+		client:  client,
+		onRetry: onRetry,
+	}
+}
+
+func (c *retryingDynamoDbClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	var output *dynamodb.GetItemOutput
+	err := c.withRetry(ctx, "GetItem", func() error {
+		var err error
+		output, err = c.client.GetItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingDynamoDbClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	var output *dynamodb.PutItemOutput
+	err := c.withRetry(ctx, "PutItem", func() error {
+		var err error
+		output, err = c.client.PutItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingDynamoDbClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	var output *dynamodb.UpdateItemOutput
+	err := c.withRetry(ctx, "UpdateItem", func() error {
+		var err error
+		output, err = c.client.UpdateItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingDynamoDbClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	var output *dynamodb.DeleteItemOutput
+	err := c.withRetry(ctx, "DeleteItem", func() error {
+		var err error
+		output, err = c.client.DeleteItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingDynamoDbClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	var output *dynamodb.QueryOutput
+	err := c.withRetry(ctx, "Query", func() error {
+		var err error
+		output, err = c.client.Query(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingDynamoDbClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	var output *dynamodb.BatchGetItemOutput
+	err := c.withRetry(ctx, "BatchGetItem", func() error {
+		var err error
+		output, err = c.client.BatchGetItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingDynamoDbClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	var output *dynamodb.BatchWriteItemOutput
+	err := c.withRetry(ctx, "BatchWriteItem", func() error {
+		var err error
+		output, err = c.client.BatchWriteItem(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (c *retryingDynamoDbClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	var output *dynamodb.TransactWriteItemsOutput
+	err := c.withRetry(ctx, "TransactWriteItems", func() error {
+		var err error
+		output, err = c.client.TransactWriteItems(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+// Returns the last error when all the attempts failed, or the error of the context when the deadline came first
+func (c *retryingDynamoDbClient) withRetry(ctx context.Context, operation string, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= storageRetryMaxAttempts || !isRetryableError(err) || ctx.Err() != nil {
+			return err
+		}
+
+		err = waitBeforeRetry(ctx, attempt)
+		if err != nil {
+			return err
+		}
+		c.onRetry(operation)
+	}
+}
+
+func waitBeforeRetry(ctx context.Context, attempt int) error {
+	select {
+	case <-time.After(getStorageRetryDelay(attempt)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// The delay doubles after every attempt, the jitter spreads the retries of the concurrent requests
+func getStorageRetryDelay(attempt int) time.Duration {
+	delay := storageRetryBaseDelay << (attempt - 1)
+	if storageRetryJitter <= 0 {
+		return delay
+	}
+	jitter := storageRetryJitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	return delay - time.Duration(rand.Float64()*jitter*float64(delay))
+}
+
+// Throttling and server errors are transient, as well as the failures to reach the server
+// Validation errors, failed conditions and anything else caused by the request itself would fail again
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) && throttlingErrorCodes[apiErr.ErrorCode()] {
+		return true
+	}
+
+	var cancelled *types.TransactionCanceledException
+	if errors.As(err, &cancelled) {
+		for _, reason := range cancelled.CancellationReasons {
+			if aws.ToString(reason.Code) == "ThrottlingError" {
+				return true
+			}
+		}
+		return false
+	}
+
+	var internalErr *types.InternalServerError
+	if errors.As(err, &internalErr) {
+		return true
+	}
+
+	var responseErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() >= 500 {
+		return true
+	}
+
+	var connectionErr interface{ ConnectionError() bool }
+	if errors.As(err, &connectionErr) && connectionErr.ConnectionError() {
+		return true
+	}
+
+	return false
+}
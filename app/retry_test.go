@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fails the calls with the given errors, one per call, then succeeds
+type failingDynamoDbClient struct {
+	dynamoDbClient
+	errors []error
+	calls  int
+}
+
+func (c *failingDynamoDbClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.calls++
+	if c.calls <= len(c.errors) {
+		return nil, c.errors[c.calls-1]
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+type httpStatusError struct {
+	statusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return "http error"
+}
+
+func (e *httpStatusError) HTTPStatusCode() int {
+	return e.statusCode
+}
+
+// Restores the default policy when the test is over
+func setupRetryPolicy(t *testing.T, maxAttempts int, baseDelay time.Duration, jitter float64) {
+	SetStorageRetryPolicy(maxAttempts, baseDelay, jitter)
+	t.Cleanup(func() {
+		SetStorageRetryPolicy(3, time.Duration(50)*time.Millisecond, 0.5)
+	})
+}
+
+func newCountingRetryingClient(client dynamoDbClient) (dynamoDbClient, map[string]int) {
+	retries := map[string]int{}
+	return newRetryingDynamoDbClient(client, func(operation string) {
+		retries[operation]++
+	}), retries
+}
+
+func TestRetryThrottledCall(t *testing.T) {
+	setupRetryPolicy(t, 3, time.Millisecond, 0)
+	failing := &failingDynamoDbClient{errors: []error{
+		&types.ProvisionedThroughputExceededException{},
+		&types.RequestLimitExceeded{},
+	}}
+	client, retries := newCountingRetryingClient(failing)
+
+	_, err := client.PutItem(context.Background(), &dynamodb.PutItemInput{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, failing.calls)
+	assert.Equal(t, 2, retries["PutItem"])
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	setupRetryPolicy(t, 2, time.Millisecond, 0)
+	throttled := &types.ProvisionedThroughputExceededException{}
+	failing := &failingDynamoDbClient{errors: []error{throttled, throttled, throttled}}
+	client, retries := newCountingRetryingClient(failing)
+
+	_, err := client.PutItem(context.Background(), &dynamodb.PutItemInput{})
+
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 2, failing.calls)
+	assert.Equal(t, 1, retries["PutItem"])
+}
+
+func TestRetryDoesNotRetryValidationError(t *testing.T) {
+	setupRetryPolicy(t, 3, time.Millisecond, 0)
+	failing := &failingDynamoDbClient{errors: []error{&httpStatusError{statusCode: 400}}}
+	client, retries := newCountingRetryingClient(failing)
+
+	_, err := client.PutItem(context.Background(), &dynamodb.PutItemInput{})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, failing.calls)
+	assert.Equal(t, 0, retries["PutItem"])
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	setupRetryPolicy(t, 3, time.Minute, 0)
+	failing := &failingDynamoDbClient{errors: []error{&types.InternalServerError{}}}
+	client, _ := newCountingRetryingClient(failing)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{})
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 1, failing.calls)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, isRetryableError(&types.ProvisionedThroughputExceededException{}))
+	assert.True(t, isRetryableError(&types.RequestLimitExceeded{}))
+	assert.True(t, isRetryableError(&types.InternalServerError{}))
+	assert.True(t, isRetryableError(&httpStatusError{statusCode: 503}))
+	assert.True(t, isRetryableError(&types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{{Code: aws.String("ThrottlingError")}},
+	}))
+
+	assert.False(t, isRetryableError(&httpStatusError{statusCode: 400}))
+	assert.False(t, isRetryableError(&types.ConditionalCheckFailedException{}))
+	assert.False(t, isRetryableError(&types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}},
+	}))
+	assert.False(t, isRetryableError(context.DeadlineExceeded))
+	assert.False(t, isRetryableError(errors.New("validation failed")))
+}
+
+func TestStorageRetryDelayDoubles(t *testing.T) {
+	setupRetryPolicy(t, 5, time.Duration(10)*time.Millisecond, 0)
+
+	assert.Equal(t, time.Duration(10)*time.Millisecond, getStorageRetryDelay(1))
+	assert.Equal(t, time.Duration(20)*time.Millisecond, getStorageRetryDelay(2))
+	assert.Equal(t, time.Duration(40)*time.Millisecond, getStorageRetryDelay(3))
+}
+
+func TestStorageRetryDelayJitter(t *testing.T) {
+	setupRetryPolicy(t, 5, time.Duration(10)*time.Millisecond, 0.5)
+
+	for i := 0; i < 100; i++ {
+		delay := getStorageRetryDelay(2)
+		assert.True(t, delay > time.Duration(10)*time.Millisecond)
+		assert.True(t, delay <= time.Duration(20)*time.Millisecond)
+	}
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const REVIEW_TOP_PRIORITIES_MAX = 5
+
+type yearContainerData struct {
+	Year int `uri:"year" binding:"required"`
+}
+
+type reviewData struct {
+	Year          int                  `json:"year"`
+	WinDays       int                  `json:"winDays"`
+	AwesomeDays   int                  `json:"awesomeDays"`
+	BestMonth     *reviewMonthData     `json:"bestMonth"`
+	LongestStreak streakData           `json:"longestStreak"`
+	TopPriorities []reviewPriorityData `json:"topPriorities"`
+	MissingDays   []string             `json:"missingDays"`
+}
+
+type reviewMonthData struct {
+	Month   string `json:"month"`
+	WinDays int    `json:"winDays"`
+}
+
+type reviewPriorityData struct {
+	Id      string `json:"id"`
+	Text    string `json:"text"`
+	Color   int    `json:"color"`
+	WinDays int    `json:"winDays"`
+}
+
+func handleGetReview(c *gin.Context, userId string, email string) {
+	// get year from URL
+	var yearContainer yearContainerData
+	if err := c.ShouldBindUri(&yearContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// the server does not know the user's timezone, so the client can tell what day it is
+	var todayContainer todayContainerData
+	if err := c.ShouldBindQuery(&todayContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+	today := todayContainer.Today
+	if today == "" {
+		today = time.Now().UTC().Format("20060102")
+	}
+
+	// sanitize
+	from := fmt.Sprintf("%04d0101", yearContainer.Year)
+	to := fmt.Sprintf("%04d1231", yearContainer.Year)
+	if !isDateValid(from) || !isDateValid(to) {
+		err := fmt.Errorf("invalid value '%d' for 'year'", yearContainer.Year)
+		toBadRequest(c, err)
+		return
+	}
+	if !isDateValid(today) {
+		err := fmt.Errorf("invalid value '%s' for 'today'", today)
+		toBadRequest(c, err)
+		return
+	}
+
+	winDays, err := getWinDayStatsInChunks(c.Request.Context(), userId, from, to)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	priorityList, _, err := dataStore.getPriorities(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+	priorities := []priorityData{}
+	if priorityList != nil {
+		priorities = priorityList.Items
+	}
+
+	// the days that are yet to come are not missing
+	if today < to {
+		to = today
+	}
+
+	toSuccessWithETag(c, getReview(yearContainer.Year, winDays, priorities, from, to))
+}
+
+// Requests the stats in the chunks the storage allows, so the interval can be of any length
+func getWinDayStatsInChunks(ctx context.Context, userId string, from string, to string) ([]winOnDayShortData, error) {
+	start, err := time.Parse("20060102", from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse("20060102", to)
+	if err != nil {
+		return nil, err
+	}
+
+	winDays := []winOnDayShortData{}
+	for chunkStart := start; !chunkStart.After(end); {
+		chunkEnd := chunkStart.AddDate(0, 0, STATS_INTERVAL_REQUESTED_MAX_DAYS-1)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		chunk, err := dataStore.getWinDayStats(ctx, userId, chunkStart.Format("20060102"), chunkEnd.Format("20060102"))
+		if err != nil {
+			return nil, err
+		}
+		winDays = append(winDays, chunk...)
+
+		chunkStart = chunkEnd.AddDate(0, 0, 1)
+	}
+
+	return winDays, nil
+}
+
+// Expects win days in ascending order, missing days are calculated in [from:to]
+func getReview(year int, winDays []winOnDayShortData, priorities []priorityData, from string, to string) reviewData {
+	review := reviewData{
+		Year:          year,
+		TopPriorities: []reviewPriorityData{},
+		MissingDays:   []string{},
+	}
+
+	recordedDays := map[string]bool{}
+	winDaysByMonth := map[string]int{}
+	winDaysByPriority := map[string]int{}
+	winDates := []string{}
+	for _, winDay := range winDays {
+		recordedDays[winDay.Date] = true
+		if !isWinDay(winDay.Win.OverallResult) {
+			continue
+		}
+
+		review.WinDays++
+		if winDay.Win.OverallResult == OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT {
+			review.AwesomeDays++
+		}
+		winDaysByMonth[winDay.Date[:6]]++
+		for _, p := range winDay.Win.Priorities {
+			winDaysByPriority[p]++
+		}
+		winDates = append(winDates, winDay.Date)
+	}
+
+	// the earliest of the best months wins
+	months := make([]string, 0, len(winDaysByMonth))
+	for month := range winDaysByMonth {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	for _, month := range months {
+		if review.BestMonth == nil || winDaysByMonth[month] > review.BestMonth.WinDays {
+			review.BestMonth = &reviewMonthData{
+				Month:   month,
+				WinDays: winDaysByMonth[month],
+			}
+		}
+	}
+
+	review.LongestStreak = getStreaks(winDates, to).Longest
+
+	// priorities keep the order of the list when worked on the same number of days
+	for _, p := range priorities {
+		if winDaysByPriority[p.Id] > 0 {
+			review.TopPriorities = append(review.TopPriorities, reviewPriorityData{
+				Id:      p.Id,
+				Text:    p.Text,
+				Color:   p.Color,
+				WinDays: winDaysByPriority[p.Id],
+			})
+		}
+	}
+	sort.SliceStable(review.TopPriorities, func(i, j int) bool {
+		return review.TopPriorities[i].WinDays > review.TopPriorities[j].WinDays
+	})
+	if len(review.TopPriorities) > REVIEW_TOP_PRIORITIES_MAX {
+		review.TopPriorities = review.TopPriorities[:REVIEW_TOP_PRIORITIES_MAX]
+	}
+
+	start, err := time.Parse("20060102", from)
+	if err != nil {
+		return review
+	}
+	end, err := time.Parse("20060102", to)
+	if err != nil {
+		return review
+	}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		date := d.Format("20060102")
+		if !recordedDays[date] {
+			review.MissingDays = append(review.MissingDays, date)
+		}
+	}
+
+	return review
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReview(t *testing.T) {
+	winDays := []winOnDayShortData{
+		{Date: "20210101", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN, Priorities: []string{"001"}}},
+		{Date: "20210102", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT, Priorities: []string{"001", "002"}}},
+		{Date: "20210104", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_COULD_NOT_GET_MY_WIN, Priorities: []string{"002"}}},
+		{Date: "20210201", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN, Priorities: []string{"002"}}},
+	}
+	priorities := []priorityData{
+		{Id: "001", Text: "Health", Color: 1},
+		{Id: "002", Text: "Work", Color: 2},
+		{Id: "003", Text: "Family", Color: 3},
+	}
+
+	review := getReview(2021, winDays, priorities, "20210101", "20210205")
+
+	assert.Equal(t, 3, review.WinDays)
+	assert.Equal(t, 1, review.AwesomeDays)
+	assert.Equal(t, &reviewMonthData{Month: "202101", WinDays: 2}, review.BestMonth)
+	assert.Equal(t, streakData{Start: "20210101", End: "20210102", Length: 2}, review.LongestStreak)
+	assert.Equal(t, []reviewPriorityData{
+		{Id: "001", Text: "Health", Color: 1, WinDays: 2},
+		{Id: "002", Text: "Work", Color: 2, WinDays: 2},
+	}, review.TopPriorities)
+	assert.Equal(t, 36-4, len(review.MissingDays))
+	assert.Equal(t, "20210103", review.MissingDays[0])
+}
+
+func TestGetWinDayStatsInChunks(t *testing.T) {
+	ctx := context.Background()
+	dataStore = NewInMemoryStore()
+	dataStore.updateWin(ctx, "user", "20200101", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	dataStore.updateWin(ctx, "user", "20210204", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	dataStore.updateWin(ctx, "user", "20210205", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	dataStore.updateWin(ctx, "user", "20211231", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+
+	winDays, err := getWinDayStatsInChunks(ctx, "user", "20200101", "20211231")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(winDays))
+	assert.Equal(t, "20200101", winDays[0].Date)
+	assert.Equal(t, "20211231", winDays[3].Date)
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SEARCH_QUERY_MAX_LENGTH = 100
+	SEARCH_RESULTS_MAX      = 50
+	SEARCH_SNIPPET_CONTEXT  = 40
+)
+
+type searchQueryContainerData struct {
+	Query    string `form:"q"`
+	From     string `form:"from"`
+	To       string `form:"to"`
+	Priority string `form:"priority"`
+}
+
+type searchResultListData struct {
+	Items []searchResultData `json:"items"`
+}
+
+type searchResultData struct {
+	Date    string  `json:"date"`
+	Win     winData `json:"win"`
+	Snippet string  `json:"snippet"`
+}
+
+func handleGetSearch(c *gin.Context, userId string, email string) {
+	// get query from the query string
+	var queryContainer searchQueryContainerData
+	if err := c.ShouldBindQuery(&queryContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// sanitize
+	tokens := tokenize(queryContainer.Query)
+	if len(tokens) == 0 || len(queryContainer.Query) > SEARCH_QUERY_MAX_LENGTH {
+		err := fmt.Errorf("invalid value '%s' for 'q', should contain at least one word and be less than %d characters long",
+			queryContainer.Query,
+			SEARCH_QUERY_MAX_LENGTH)
+		toBadRequest(c, err)
+		return
+	}
+	if queryContainer.From != "" && !isDateValid(queryContainer.From) {
+		err := fmt.Errorf("invalid value '%s' for 'from'", queryContainer.From)
+		toBadRequest(c, err)
+		return
+	}
+	if queryContainer.To != "" && !isDateValid(queryContainer.To) {
+		err := fmt.Errorf("invalid value '%s' for 'to'", queryContainer.To)
+		toBadRequest(c, err)
+		return
+	}
+	if queryContainer.Priority != "" && !isPriorityIdValid(queryContainer.Priority) {
+		err := fmt.Errorf("invalid value '%s' for 'priority', should be less than %d characters long",
+			queryContainer.Priority,
+			PRIORITY_ID_MAX_LENGTH)
+		toBadRequest(c, err)
+		return
+	}
+
+	query := searchQueryData{
+		Tokens:   tokens,
+		From:     queryContainer.From,
+		To:       queryContainer.To,
+		Priority: queryContainer.Priority,
+	}
+	wins, err := winSearchIndex.search(c.Request.Context(), userId, query, SEARCH_RESULTS_MAX)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	results := searchResultListData{
+		Items: make([]searchResultData, len(wins)),
+	}
+	for i, winOnDay := range wins {
+		results.Items[i] = searchResultData{
+			Date:    winOnDay.Date,
+			Win:     normalizeWin(winOnDay.Win),
+			Snippet: getSnippet(winOnDay.Win.Text, tokens),
+		}
+	}
+
+	toSuccess(c, results)
+}
+
+// Cuts the text around the first word matching any of the tokens
+func getSnippet(text string, tokens []string) string {
+	runes := []rune(text)
+	lowerRunes := make([]rune, len(runes))
+	for i, r := range runes {
+		lowerRunes[i] = unicode.ToLower(r)
+	}
+
+	// find the earliest match, in runes
+	matchStart := 0
+	matchEnd := 0
+	for _, index := range findWordStarts(lowerRunes) {
+		word := string(lowerRunes[index:])
+		for _, token := range tokens {
+			if strings.HasPrefix(word, token) {
+				matchStart = index
+				matchEnd = index + len([]rune(token))
+				break
+			}
+		}
+		if matchEnd > 0 {
+			break
+		}
+	}
+
+	start := matchStart - SEARCH_SNIPPET_CONTEXT
+	if start < 0 {
+		start = 0
+	}
+	end := matchEnd + SEARCH_SNIPPET_CONTEXT
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet = snippet + "..."
+	}
+	return snippet
+}
+
+func findWordStarts(runes []rune) []int {
+	starts := []int{}
+	isInWord := false
+	for i, r := range runes {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && !isInWord {
+			starts = append(starts, i)
+		}
+		isInWord = isWordRune
+	}
+	return starts
+}
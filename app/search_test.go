@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSearchTestData() *searchIndex {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Finished the marathon!", Priorities: []string{"001"}}, "")
+	store.updateWin(ctx, "user", "20211002", winData{Text: "Rested after the Marathon"}, "")
+	store.updateWin(ctx, "user", "20211003", winData{Text: "Went to work"}, "")
+	store.updateWin(ctx, "another user", "20211001", winData{Text: "Marathon"}, "")
+
+	winSearchIndex = newSearchIndex(store, 10, time.Minute)
+	dataStore = newIndexingStore(store, winSearchIndex)
+	return winSearchIndex
+}
+
+func searchDates(index *searchIndex, query searchQueryData) []string {
+	wins, _ := index.search(context.Background(), "user", query, SEARCH_RESULTS_MAX)
+	dates := []string{}
+	for _, winOnDay := range wins {
+		dates = append(dates, winOnDay.Date)
+	}
+	return dates
+}
+
+func TestSearch(t *testing.T) {
+	index := setupSearchTestData()
+
+	assert.Equal(t, []string{"20211002", "20211001"}, searchDates(index, searchQueryData{Tokens: []string{"marath"}}))
+	assert.Equal(t, []string{"20211001"}, searchDates(index, searchQueryData{Tokens: []string{"marathon", "finished"}}))
+	assert.Equal(t, []string{"20211001"}, searchDates(index, searchQueryData{Tokens: []string{"marathon"}, Priority: "001"}))
+	assert.Equal(t, []string{"20211002"}, searchDates(index, searchQueryData{Tokens: []string{"marathon"}, From: "20211002"}))
+	assert.Equal(t, []string{}, searchDates(index, searchQueryData{Tokens: []string{"athon"}}))
+}
+
+func TestSearchIndexIsKeptInSync(t *testing.T) {
+	index := setupSearchTestData()
+	ctx := context.Background()
+	assert.Equal(t, []string{"20211003"}, searchDates(index, searchQueryData{Tokens: []string{"work"}}))
+
+	dataStore.updateWin(ctx, "user", "20211003", winData{Text: "Went for a run"}, "")
+	dataStore.updateWins(ctx, "user", []winOnDayData{{Date: "20211004", Win: winData{Text: "Back to work"}}})
+
+	assert.Equal(t, []string{"20211004"}, searchDates(index, searchQueryData{Tokens: []string{"work"}}))
+	assert.Equal(t, []string{"20211003"}, searchDates(index, searchQueryData{Tokens: []string{"run"}}))
+
+	dataStore.deleteWin(ctx, "user", "20211003", "")
+
+	assert.Equal(t, []string{}, searchDates(index, searchQueryData{Tokens: []string{"run"}}))
+
+	dataStore.deleteAllWins(ctx, "user")
+
+	assert.Equal(t, []string{}, searchDates(index, searchQueryData{Tokens: []string{"work"}}))
+}
+
+func TestSearchIndexExpires(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Went to work"}, "")
+	index := newSearchIndex(store, 10, time.Duration(0))
+	assert.Equal(t, []string{"20211001"}, searchDates(index, searchQueryData{Tokens: []string{"work"}}))
+
+	// updated through another instance
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Went for a run"}, "")
+
+	assert.Equal(t, []string{}, searchDates(index, searchQueryData{Tokens: []string{"work"}}))
+	assert.Equal(t, []string{"20211001"}, searchDates(index, searchQueryData{Tokens: []string{"run"}}))
+}
+
+func TestGetSnippet(t *testing.T) {
+	assert.Equal(t, "Finished the marathon!", getSnippet("Finished the marathon!", []string{"marathon"}))
+	assert.Equal(t,
+		"...ox jumps over the lazy dog and then the Marathon started, the fox jumps over the lazy do...",
+		getSnippet("Long story short, the quick brown fox jumps over the lazy dog and then the Marathon started, the fox jumps over the lazy dog, again", []string{"marathon"}))
+}
+
+func TestSearchResultsAreNormalized(t *testing.T) {
+	setupSearchTestData()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/search?q=work", nil)
+
+	handleGetSearch(c, "user", "user@example.com")
+
+	var response struct {
+		Data searchResultListData `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 1, len(response.Data.Items))
+	win := response.Data.Items[0].Win
+	assert.Equal(t, []string{}, win.Tags)
+	assert.Equal(t, []winEntryData{{Id: WIN_LEGACY_ENTRY_ID, Text: "Went to work", Priorities: []string{}}}, win.Entries)
+	assert.Contains(t, w.Body.String(), `"tags":[]`)
+}
@@ -0,0 +1,328 @@
+package app
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var searchIndexMaxUsers = 100
+var searchIndexTtl = time.Duration(1) * time.Minute
+
+// Keeps the decoded win text of the recently searching users in memory, so it can be searched
+// The user index is built on the first search and then kept in sync with every update made through indexingStore
+// Updates made through other instances are not seen, so the user index is rebuilt once it is older than ttl
+type searchIndex struct {
+	lock          sync.Mutex
+	store         Store
+	maxUsers      int
+	ttl           time.Duration
+	lru           *list.List // most recently searched in front
+	users         map[string]*list.Element
+	invalidations uint64
+}
+
+type userSearchIndex struct {
+	userId  string
+	builtAt time.Time
+	wins    map[string]winData
+	tokens  map[string]map[string]bool // token -> dates
+}
+
+type searchQueryData struct {
+	Tokens   []string
+	From     string
+	To       string
+	Priority string
+}
+
+// Updates made through this store are reflected in the search index
+type indexingStore struct {
+	Store
+	index *searchIndex
+}
+
+var winSearchIndex *searchIndex
+
+func SetSearchIndexMaxUsers(maxUsers int) {
+	searchIndexMaxUsers = maxUsers
+}
+
+func SetSearchIndexTtl(ttl time.Duration) {
+	searchIndexTtl = ttl
+}
+
+func newSearchIndex(store Store, maxUsers int, ttl time.Duration) *searchIndex {
+	return &searchIndex{
+		store:    store,
+		maxUsers: maxUsers,
+		ttl:      ttl,
+		lru:      list.New(),
+		users:    map[string]*list.Element{},
+	}
+}
+
+func newIndexingStore(store Store, index *searchIndex) Store {
+	return &indexingStore{
+		Store: store,
+		index: index,
+	}
+}
+
+func (s *indexingStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	err := s.Store.updateWin(ctx, userId, date, win, expectedVersion)
+	if err == errConflict {
+		return err
+	}
+	if err != nil {
+		// not sure what has been saved
+		s.index.drop(userId)
+		return err
+	}
+	s.index.updateWin(userId, date, win)
+	return nil
+}
+
+func (s *indexingStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	written, err := s.Store.updateWins(ctx, userId, wins)
+	if err != nil {
+		// not sure what has been saved
+		s.index.drop(userId)
+		return written, err
+	}
+	for _, winOnDay := range wins {
+		s.index.updateWin(userId, winOnDay.Date, winOnDay.Win)
+	}
+	return written, nil
+}
+
+func (s *indexingStore) patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error) {
+	win, err := s.Store.patchWin(ctx, userId, date, patch, expectedVersion)
+	if err == errConflict {
+		return nil, err
+	}
+	if err != nil {
+		// not sure what has been saved
+		s.index.drop(userId)
+		return nil, err
+	}
+	s.index.updateWin(userId, date, *win)
+	return win, nil
+}
+
+func (s *indexingStore) deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error {
+	err := s.Store.deleteWin(ctx, userId, date, expectedVersion)
+	if err == errConflict {
+		return err
+	}
+	if err != nil {
+		// not sure whether it has been deleted
+		s.index.drop(userId)
+		return err
+	}
+	s.index.deleteWin(userId, date)
+	return nil
+}
+
+func (s *indexingStore) deleteAllWins(ctx context.Context, userId string) error {
+	defer s.index.drop(userId)
+	return s.Store.deleteAllWins(ctx, userId)
+}
+
+// The wins are hidden while the deletion is pending, and shown again when it is cancelled
+func (s *indexingStore) saveDeletionRequest(ctx context.Context, userId string, request deletionRequestData, expected *deletionRequestData) error {
+	defer s.index.drop(userId)
+	return s.Store.saveDeletionRequest(ctx, userId, request, expected)
+}
+
+func (s *indexingStore) deleteDeletionRequest(ctx context.Context, userId string, expected *deletionRequestData) error {
+	defer s.index.drop(userId)
+	return s.Store.deleteDeletionRequest(ctx, userId, expected)
+}
+
+// Returns matching wins, the most recent first
+// Every query token should match the beginning of some word in the win text
+func (i *searchIndex) search(ctx context.Context, userId string, query searchQueryData, limit int) ([]winOnDayData, error) {
+	now := time.Now()
+
+	i.lock.Lock()
+	element, ok := i.users[userId]
+	if ok && now.Sub(element.Value.(*userSearchIndex).builtAt) >= i.ttl {
+		i.remove(element)
+		ok = false
+	}
+	if ok {
+		i.lru.MoveToFront(element)
+		results := element.Value.(*userSearchIndex).search(query, limit)
+		i.lock.Unlock()
+		return results, nil
+	}
+	token := i.invalidations
+	i.lock.Unlock()
+
+	// build without holding the lock, reading all the wins may take a while
+	userIndex := newUserSearchIndex(userId, now)
+	err := i.store.forEachWin(ctx, userId, func(winOnDay winOnDayData) error {
+		userIndex.add(winOnDay.Date, winOnDay.Win)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	// the index built before the update would miss the update, so it is only good for this search
+	if token == i.invalidations {
+		i.users[userId] = i.lru.PushFront(userIndex)
+		for i.lru.Len() > i.maxUsers {
+			i.remove(i.lru.Back())
+		}
+	}
+	return userIndex.search(query, limit), nil
+}
+
+func (i *searchIndex) updateWin(userId string, date string, win winData) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.invalidations++
+	if element, ok := i.users[userId]; ok {
+		element.Value.(*userSearchIndex).add(date, win)
+	}
+}
+
+func (i *searchIndex) deleteWin(userId string, date string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.invalidations++
+	if element, ok := i.users[userId]; ok {
+		element.Value.(*userSearchIndex).remove(date)
+	}
+}
+
+func (i *searchIndex) drop(userId string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.invalidations++
+	if element, ok := i.users[userId]; ok {
+		i.remove(element)
+	}
+}
+
+// expects the lock to be held by the caller
+func (i *searchIndex) remove(element *list.Element) {
+	userIndex := i.lru.Remove(element).(*userSearchIndex)
+	delete(i.users, userIndex.userId)
+}
+
+func newUserSearchIndex(userId string, builtAt time.Time) *userSearchIndex {
+	return &userSearchIndex{
+		userId:  userId,
+		builtAt: builtAt,
+		wins:    map[string]winData{},
+		tokens:  map[string]map[string]bool{},
+	}
+}
+
+// Replaces the win previously indexed on the same date
+func (u *userSearchIndex) add(date string, win winData) {
+	u.remove(date)
+
+	u.wins[date] = copyWin(win)
+	for _, token := range tokenize(win.Text) {
+		dates, ok := u.tokens[token]
+		if !ok {
+			dates = map[string]bool{}
+			u.tokens[token] = dates
+		}
+		dates[date] = true
+	}
+}
+
+func (u *userSearchIndex) remove(date string) {
+	previous, ok := u.wins[date]
+	if !ok {
+		return
+	}
+
+	for _, token := range tokenize(previous.Text) {
+		delete(u.tokens[token], date)
+		if len(u.tokens[token]) == 0 {
+			delete(u.tokens, token)
+		}
+	}
+	delete(u.wins, date)
+}
+
+func (u *userSearchIndex) search(query searchQueryData, limit int) []winOnDayData {
+	if len(query.Tokens) == 0 {
+		return []winOnDayData{}
+	}
+
+	// dates matching all the tokens
+	var matches map[string]bool
+	for _, queryToken := range query.Tokens {
+		tokenMatches := map[string]bool{}
+		for token, dates := range u.tokens {
+			if strings.HasPrefix(token, queryToken) {
+				for date := range dates {
+					if matches == nil || matches[date] {
+						tokenMatches[date] = true
+					}
+				}
+			}
+		}
+		matches = tokenMatches
+	}
+
+	dates := make([]string, 0, len(matches))
+	for date := range matches {
+		if query.From != "" && date < query.From {
+			continue
+		}
+		if query.To != "" && date > query.To {
+			continue
+		}
+		if query.Priority != "" && !containsString(u.wins[date].Priorities, query.Priority) {
+			continue
+		}
+		dates = append(dates, date)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	if len(dates) > limit {
+		dates = dates[:limit]
+	}
+
+	results := make([]winOnDayData, len(dates))
+	for i, date := range dates {
+		results[i] = winOnDayData{
+			Date: date,
+			Win:  copyWin(u.wins[date]),
+		}
+	}
+	return results
+}
+
+// Splits the text into lower-case words, ignoring punctuation
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
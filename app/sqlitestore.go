@@ -0,0 +1,1234 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// mirrors the DynamoDB table, so the data model stays the same
+const SQLITE_SCHEMA = `
+CREATE TABLE IF NOT EXISTS winaday (
+	"Key"         TEXT NOT NULL,
+	"SortKey"     TEXT NOT NULL,
+	"text"        TEXT,
+	"overall"     INTEGER,
+	"priorities"  TEXT,
+	"entries"     TEXT,
+	"tags"        TEXT,
+	"items"       TEXT,
+	"udpatedAt"   TEXT,
+	"requestedAt" TEXT,
+	"purgeAt"     TEXT,
+	"job"         TEXT,
+	PRIMARY KEY ("Key", "SortKey")
+)`
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Opens (or creates) the database file and makes sure the schema exists
+func NewSqliteStore(path string) (Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite does not support concurrent writes, serialize everything
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(SQLITE_SCHEMA)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+// Checks the version and writes the win in the same transaction, so the win cannot change in between
+func (s *sqliteStore) updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	sortKey := date
+
+	// encode data
+	row, err := encodeSqliteWin(win)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	defer tx.Rollback()
+
+	// make sure the win is the expected version
+	if expectedVersion != "" {
+		current, err := getSqliteWinInTx(ctx, tx, hashKey, sortKey)
+		if err != nil {
+			return err
+		}
+		if err = checkStoredWinVersion(current, expectedVersion); err != nil {
+			return err
+		}
+	}
+
+	// run query
+	_, err = tx.ExecContext(ctx,
+		SQLITE_UPSERT_WIN,
+		append([]interface{}{hashKey, sortKey, generateTimestamp()}, row.values()...)...)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// done
+	return nil
+}
+
+// Returns nil when there is no win on that date
+func getSqliteWinInTx(ctx context.Context, tx *sql.Tx, hashKey string, sortKey string) (*winData, error) {
+	var winRow sqliteWinRow
+	err := tx.QueryRowContext(ctx,
+		`SELECT `+SQLITE_WIN_COLUMNS+` FROM winaday WHERE "Key" = ? AND "SortKey" = ?`,
+		hashKey, sortKey).Scan(winRow.fields()...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	return decodeSqliteWin(&winRow)
+}
+
+// Writes wins in batches, every batch in its own transaction, so the batch is either written as a whole or not at all
+func (s *sqliteStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	written := make([]string, 0, len(wins))
+	for start := 0; start < len(wins); start += BATCH_SIZE {
+		end := start + BATCH_SIZE
+		if end > len(wins) {
+			end = len(wins)
+		}
+
+		err := s.updateWinsInBatch(ctx, userId, wins[start:end])
+		if err != nil {
+			return written, logAndConvertError(err)
+		}
+		for _, winOnDay := range wins[start:end] {
+			written = append(written, winOnDay.Date)
+		}
+	}
+
+	return written, nil
+}
+
+func (s *sqliteStore) updateWinsInBatch(ctx context.Context, userId string, batch []winOnDayData) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, winOnDay := range batch {
+		// encode data
+		row, err := encodeSqliteWin(winOnDay.Win)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			SQLITE_UPSERT_WIN,
+			append([]interface{}{hashKey, winOnDay.Date, generateTimestamp()}, row.values()...)...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Reads and writes the win in the same transaction, so the concurrent updates are not lost
+func (s *sqliteStore) patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	sortKey := date
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer tx.Rollback()
+
+	// read the current win
+	win, err := getSqliteWinInTx(ctx, tx, hashKey, sortKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStoredWinVersion(win, expectedVersion); err != nil {
+		return nil, err
+	}
+	if win == nil {
+		win = &winData{Priorities: []string{}}
+	}
+
+	patched, err := applyWinPatch(*win, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	// write it back
+	row, err := encodeSqliteWin(patched)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	_, err = tx.ExecContext(ctx,
+		SQLITE_UPSERT_WIN,
+		append([]interface{}{hashKey, sortKey, generateTimestamp()}, row.values()...)...)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	return &patched, nil
+}
+
+func (s *sqliteStore) getWin(ctx context.Context, userId string, date string) (*winData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	sortKey := date
+
+	// run query
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+SQLITE_WIN_COLUMNS+` FROM winaday WHERE "Key" = ? AND "SortKey" = ?`,
+		hashKey, sortKey)
+
+	// re-pack the results
+	var winRow sqliteWinRow
+	err := row.Scan(winRow.fields()...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	return decodeSqliteWin(&winRow)
+}
+
+func (s *sqliteStore) deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	tombstoneHashKey := fmt.Sprintf("DELETED#%s", userId)
+	sortKey := date
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	defer tx.Rollback()
+
+	// make sure the win is the expected version
+	if expectedVersion != "" {
+		current, err := getSqliteWinInTx(ctx, tx, hashKey, sortKey)
+		if err != nil {
+			return err
+		}
+		if err = checkStoredWinVersion(current, expectedVersion); err != nil {
+			return err
+		}
+	}
+
+	// run query
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM winaday WHERE "Key" = ? AND "SortKey" = ?`,
+		hashKey, sortKey)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	if deleted == 0 {
+		return nil
+	}
+
+	// leave the tombstone
+	_, err = tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO winaday ("Key", "SortKey", "udpatedAt") VALUES (?, ?, ?)`,
+		tombstoneHashKey, sortKey, generateTimestamp())
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// done
+	return nil
+}
+
+func (s *sqliteStore) getWinsOnDates(ctx context.Context, userId string, dates []string) ([]winOnDayData, error) {
+	if len(dates) == 0 {
+		return []winOnDayData{}, nil
+	}
+
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	args := []interface{}{hashKey}
+	for _, date := range dates {
+		args = append(args, date)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(dates)), ", ")
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", `+SQLITE_WIN_COLUMNS+` FROM winaday
+		WHERE "Key" = ? AND "SortKey" IN (`+placeholders+`)`,
+		args...)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	wins := make([]winOnDayData, 0, len(dates))
+	for rows.Next() {
+		var date string
+		var winRow sqliteWinRow
+		err = rows.Scan(append([]interface{}{&date}, winRow.fields()...)...)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		win, err := decodeSqliteWin(&winRow)
+		if err != nil {
+			return nil, err
+		}
+
+		wins = append(wins, winOnDayData{
+			Date: date,
+			Win:  *win,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return wins, nil
+}
+
+func (s *sqliteStore) getWins(ctx context.Context, userId string, from string, to string) ([]winOnDayData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", `+SQLITE_WIN_COLUMNS+` FROM winaday
+		WHERE "Key" = ? AND "SortKey" BETWEEN ? AND ? ORDER BY "SortKey"`,
+		hashKey, from, to)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	wins := make([]winOnDayData, 0)
+	for rows.Next() {
+		var date string
+		var winRow sqliteWinRow
+		err = rows.Scan(append([]interface{}{&date}, winRow.fields()...)...)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		win, err := decodeSqliteWin(&winRow)
+		if err != nil {
+			return nil, err
+		}
+
+		wins = append(wins, winOnDayData{
+			Date: date,
+			Win:  *win,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return wins, nil
+}
+
+func (s *sqliteStore) getWinDays(ctx context.Context, userId string, from string, to string) ([]string, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey" FROM winaday
+		WHERE "Key" = ? AND "SortKey" BETWEEN ? AND ? AND "overall" IN (?, ?) ORDER BY "SortKey"`,
+		hashKey, from, to, OVERALL_DAY_RESULT_GOT_MY_WIN, OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	days := make([]string, 0)
+	for rows.Next() {
+		var date string
+		err = rows.Scan(&date)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		days = append(days, date)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return days, nil
+}
+
+func (s *sqliteStore) getWinDayStats(ctx context.Context, userId string, from string, to string) ([]winOnDayShortData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", "overall", "priorities", "tags" FROM winaday
+		WHERE "Key" = ? AND "SortKey" BETWEEN ? AND ? ORDER BY "SortKey"`,
+		hashKey, from, to)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	wins := make([]winOnDayShortData, 0)
+	for rows.Next() {
+		var date string
+		var overallResult int
+		var priorities string
+		var tags sql.NullString
+		err = rows.Scan(&date, &overallResult, &priorities, &tags)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		var priorityIds []string
+		err = json.Unmarshal([]byte(priorities), &priorityIds)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		decodedTags, err := decodeSqliteTags(tags)
+		if err != nil {
+			return nil, err
+		}
+
+		wins = append(wins, winOnDayShortData{
+			Date: date,
+			Win: winShortData{
+				OverallResult: overallResult,
+				Priorities:    priorityIds,
+				Tags:          decodedTags,
+			},
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return wins, nil
+}
+
+func (s *sqliteStore) updatePriorities(ctx context.Context, userId string, priorities priorityListData, updatedAt string, expectedVersion string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "PRIORITIES"
+	sortKey := userId
+
+	// encode data
+	encodedPriorities, err := json.Marshal(encodePriorities(priorities.Items, 100))
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// unconditional update
+	if expectedVersion == "" {
+		_, err = s.db.ExecContext(ctx,
+			`INSERT OR REPLACE INTO winaday ("Key", "SortKey", "items", "udpatedAt") VALUES (?, ?, ?, ?)`,
+			hashKey, sortKey, string(encodedPriorities), updatedAt)
+		if err != nil {
+			return logAndConvertError(err)
+		}
+		return nil
+	}
+
+	// conditional update
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE winaday SET "items" = ?, "udpatedAt" = ? WHERE "Key" = ? AND "SortKey" = ? AND "udpatedAt" = ?`,
+		string(encodedPriorities), updatedAt, hashKey, sortKey, expectedVersion)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	if rowsAffected == 0 {
+		return errConflict
+	}
+
+	// done
+	return nil
+}
+
+func (s *sqliteStore) getPriorities(ctx context.Context, userId string) (*priorityListData, string, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "PRIORITIES"
+	sortKey := userId
+
+	// run query
+	row := s.db.QueryRowContext(ctx,
+		`SELECT "items", "udpatedAt" FROM winaday WHERE "Key" = ? AND "SortKey" = ?`,
+		hashKey, sortKey)
+
+	// re-pack the results
+	var items string
+	var updatedAt string
+	err := row.Scan(&items, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", logAndConvertError(err)
+	}
+
+	var prioritiesToDecode []priorityData
+	err = json.Unmarshal([]byte(items), &prioritiesToDecode)
+	if err != nil {
+		return nil, "", logAndConvertError(err)
+	}
+	prioritiesDecoded, err := decodePriorities(prioritiesToDecode)
+	if err != nil {
+		return nil, "", logAndConvertError(err)
+	}
+
+	priorityList := priorityListData{
+		Items: prioritiesDecoded,
+	}
+
+	return &priorityList, updatedAt, nil
+}
+
+// Tombstones live under their own key, so they never show up among the wins
+func (s *sqliteStore) getWinChanges(ctx context.Context, userId string, since string) ([]winChangeData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+	tombstoneHashKey := fmt.Sprintf("DELETED#%s", userId)
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", "udpatedAt", `+SQLITE_WIN_COLUMNS+` FROM winaday
+		WHERE "Key" = ? AND (? = '' OR "udpatedAt" > ?)`,
+		hashKey, since, since)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	changes := make([]winChangeData, 0)
+	for rows.Next() {
+		var date string
+		var updatedAt sql.NullString
+		var winRow sqliteWinRow
+		err = rows.Scan(append([]interface{}{&date, &updatedAt}, winRow.fields()...)...)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		win, err := decodeSqliteWin(&winRow)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, winChangeData{
+			Date:      date,
+			Win:       win,
+			UpdatedAt: updatedAt.String,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+	rows.Close()
+
+	// add tombstones
+	tombstoneRows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", "udpatedAt" FROM winaday WHERE "Key" = ? AND "udpatedAt" > ?`,
+		tombstoneHashKey, since)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer tombstoneRows.Close()
+
+	for tombstoneRows.Next() {
+		var date string
+		var deletedAt string
+		err = tombstoneRows.Scan(&date, &deletedAt)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+
+		changes = append(changes, winChangeData{
+			Date:      date,
+			Deleted:   true,
+			UpdatedAt: deletedAt,
+		})
+	}
+	if err = tombstoneRows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return changes, nil
+}
+
+// Versions are stored as wins, keyed by the date and the version, so the versions of the same date are kept together
+func (s *sqliteStore) addWinVersions(ctx context.Context, userId string, versions []winVersionData) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("HISTORY#%s", userId)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	defer tx.Rollback()
+
+	for _, version := range versions {
+		// encode data
+		row, err := encodeSqliteWin(version.Win)
+		if err != nil {
+			return logAndConvertError(err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			SQLITE_UPSERT_WIN,
+			append([]interface{}{hashKey, getWinVersionSortKey(version.Date, version.Version), version.ReplacedAt}, row.values()...)...)
+		if err != nil {
+			return logAndConvertError(err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// done
+	return nil
+}
+
+func (s *sqliteStore) getWinVersions(ctx context.Context, userId string, date string, limit int) ([]winVersionData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := fmt.Sprintf("HISTORY#%s", userId)
+	prefix := getWinVersionSortKey(date, "")
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", "udpatedAt", `+SQLITE_WIN_COLUMNS+` FROM winaday
+		WHERE "Key" = ? AND substr("SortKey", 1, ?) = ? ORDER BY "SortKey" DESC LIMIT ?`,
+		hashKey, len(prefix), prefix, limit)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	versions := make([]winVersionData, 0)
+	for rows.Next() {
+		var sortKey string
+		var replacedAt string
+		var winRow sqliteWinRow
+		err = rows.Scan(append([]interface{}{&sortKey, &replacedAt}, winRow.fields()...)...)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		win, err := decodeSqliteWin(&winRow)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, winVersionData{
+			Date:       date,
+			Version:    sortKey[len(prefix):],
+			ReplacedAt: replacedAt,
+			Win:        *win,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return versions, nil
+}
+
+func (s *sqliteStore) deleteWinVersions(ctx context.Context, userId string, date string, versions []string) error {
+	// define keys
+	hashKey := fmt.Sprintf("HISTORY#%s", userId)
+
+	sortKeys := make([]string, 0, len(versions))
+	for _, version := range versions {
+		sortKeys = append(sortKeys, getWinVersionSortKey(date, version))
+	}
+
+	return s.deleteWinsInBatch(ctx, hashKey, sortKeys)
+}
+
+// Reads page by page, so the callback is never called while the connection is busy with the query
+func (s *sqliteStore) forEachWin(ctx context.Context, userId string, callback func(winOnDayData) error) error {
+	// define keys
+	hashKey := fmt.Sprintf("WIN#%s", userId)
+
+	lastDate := ""
+	for {
+		// retrieve next page
+		page, err := s.getWinPage(ctx, hashKey, lastDate, BATCH_SIZE*4)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, winOnDay := range page {
+			err = callback(winOnDay)
+			if err != nil {
+				return err
+			}
+		}
+		lastDate = page[len(page)-1].Date
+	}
+
+	return nil
+}
+
+// Returns up to limit wins after the given date
+func (s *sqliteStore) getWinPage(ctx context.Context, hashKey string, after string, limit int) ([]winOnDayData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", `+SQLITE_WIN_COLUMNS+` FROM winaday
+		WHERE "Key" = ? AND "SortKey" > ? ORDER BY "SortKey" LIMIT ?`,
+		hashKey, after, limit)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	wins := make([]winOnDayData, 0, limit)
+	for rows.Next() {
+		var date string
+		var winRow sqliteWinRow
+		err = rows.Scan(append([]interface{}{&date}, winRow.fields()...)...)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		win, err := decodeSqliteWin(&winRow)
+		if err != nil {
+			return nil, err
+		}
+
+		wins = append(wins, winOnDayData{
+			Date: date,
+			Win:  *win,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	return wins, nil
+}
+
+// Deletes page by page, the same way it is done with DynamoDB, to keep transactions short
+func (s *sqliteStore) deleteAllWins(ctx context.Context, userId string) error {
+	for _, hashKey := range []string{
+		fmt.Sprintf("WIN#%s", userId),
+		fmt.Sprintf("DELETED#%s", userId),
+		fmt.Sprintf("HISTORY#%s", userId),
+	} {
+		err := s.deleteAllItems(ctx, hashKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) deleteAllItems(ctx context.Context, hashKey string) error {
+	for {
+		// retrieve next batch
+		batch, err := s.getWinSortKeys(ctx, hashKey, BATCH_SIZE)
+		if err != nil {
+			return logAndConvertError(err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		err = s.deleteWinsInBatch(ctx, hashKey, batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) getWinSortKeys(ctx context.Context, hashKey string, limit int) ([]string, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey" FROM winaday WHERE "Key" = ? ORDER BY "SortKey" LIMIT ?`,
+		hashKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sortKeys := make([]string, 0, limit)
+	for rows.Next() {
+		var sortKey string
+		err = rows.Scan(&sortKey)
+		if err != nil {
+			return nil, err
+		}
+		sortKeys = append(sortKeys, sortKey)
+	}
+
+	return sortKeys, rows.Err()
+}
+
+func (s *sqliteStore) deleteWinsInBatch(ctx context.Context, hashKey string, batch []string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	for _, sortKey := range batch {
+		_, err = tx.ExecContext(ctx, `DELETE FROM winaday WHERE "Key" = ? AND "SortKey" = ?`, hashKey, sortKey)
+		if err != nil {
+			tx.Rollback()
+			return logAndConvertError(err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) deletePriorities(ctx context.Context, userId string) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "PRIORITIES"
+	sortKey := userId
+
+	// run query
+	_, err := s.db.ExecContext(ctx, `DELETE FROM winaday WHERE "Key" = ? AND "SortKey" = ?`, hashKey, sortKey)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// done
+	return nil
+}
+
+func (s *sqliteStore) saveDeletionRequest(ctx context.Context, userId string, request deletionRequestData, expected *deletionRequestData) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "DELETION"
+	sortKey := userId
+
+	// encode data, the request without purgeAt is never due
+	job, err := json.Marshal(request.Job)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	purgeAt := sql.NullString{String: request.PurgeAt, Valid: request.PurgeAt != ""}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	defer tx.Rollback()
+
+	// make sure the request is still the expected one
+	err = checkSqliteDeletionRequestInTx(ctx, tx, hashKey, sortKey, expected)
+	if err != nil {
+		return err
+	}
+
+	// run query
+	_, err = tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO winaday ("Key", "SortKey", "requestedAt", "purgeAt", "job") VALUES (?, ?, ?, ?, ?)`,
+		hashKey, sortKey, request.RequestedAt, purgeAt, string(job))
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// done
+	return nil
+}
+
+// Returns errConflict when the stored request is not the expected one, any request is fine when none is expected
+func checkSqliteDeletionRequestInTx(ctx context.Context, tx *sql.Tx, hashKey string, sortKey string, expected *deletionRequestData) error {
+	if expected == nil {
+		return nil
+	}
+
+	row := tx.QueryRowContext(ctx,
+		`SELECT "SortKey", "requestedAt", "purgeAt", "job" FROM winaday WHERE "Key" = ? AND "SortKey" = ?`,
+		hashKey, sortKey)
+	stored, err := scanSqliteDeletionRequest(row)
+	if err == sql.ErrNoRows {
+		return errConflict
+	}
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	if !isSameDeletionRequest(*stored, *expected) {
+		return errConflict
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) getDeletionRequest(ctx context.Context, userId string) (*deletionRequestData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "DELETION"
+	sortKey := userId
+
+	// run query
+	row := s.db.QueryRowContext(ctx,
+		`SELECT "SortKey", "requestedAt", "purgeAt", "job" FROM winaday WHERE "Key" = ? AND "SortKey" = ?`,
+		hashKey, sortKey)
+
+	// re-pack the results
+	request, err := scanSqliteDeletionRequest(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return request, nil
+}
+
+func (s *sqliteStore) getDueDeletionRequests(ctx context.Context, now string) ([]deletionRequestData, error) {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "DELETION"
+
+	// run query
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT "SortKey", "requestedAt", "purgeAt", "job" FROM winaday WHERE "Key" = ? AND "purgeAt" <= ?`,
+		hashKey, now)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	defer rows.Close()
+
+	// re-pack the results
+	requests := make([]deletionRequestData, 0)
+	for rows.Next() {
+		request, err := scanSqliteDeletionRequest(rows)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		requests = append(requests, *request)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	// done
+	return requests, nil
+}
+
+func (s *sqliteStore) deleteDeletionRequest(ctx context.Context, userId string, expected *deletionRequestData) error {
+	// apply deadline
+	ctx, cancel := withStorageTimeout(ctx)
+	defer cancel()
+
+	// define keys
+	hashKey := "DELETION"
+	sortKey := userId
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+	defer tx.Rollback()
+
+	// make sure the request is still the expected one
+	err = checkSqliteDeletionRequestInTx(ctx, tx, hashKey, sortKey, expected)
+	if err != nil {
+		return err
+	}
+
+	// run query
+	_, err = tx.ExecContext(ctx, `DELETE FROM winaday WHERE "Key" = ? AND "SortKey" = ?`, hashKey, sortKey)
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return logAndConvertError(err)
+	}
+
+	// done
+	return nil
+}
+
+// Scans "SortKey", "requestedAt", "purgeAt" and "job" columns
+func scanSqliteDeletionRequest(row interface{ Scan(...interface{}) error }) (*deletionRequestData, error) {
+	var request deletionRequestData
+	var purgeAt sql.NullString
+	var job sql.NullString
+	err := row.Scan(&request.UserId, &request.RequestedAt, &purgeAt, &job)
+	if err != nil {
+		return nil, err
+	}
+	request.PurgeAt = purgeAt.String
+
+	// requests made before the deletion became a job have no job yet
+	if job.Valid {
+		err = json.Unmarshal([]byte(job.String), &request.Job)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &request, nil
+}
+
+// Columns of the win, in the order of sqliteWinRow fields
+const SQLITE_WIN_COLUMNS = `"text", "overall", "priorities", "entries", "tags"`
+
+// Expects the keys and the timestamp of the update, followed by sqliteWinRow values
+const SQLITE_UPSERT_WIN = `INSERT OR REPLACE INTO winaday ("Key", "SortKey", "udpatedAt", ` + SQLITE_WIN_COLUMNS + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+// Entries and tags are only stored when the win has them, so the wins saved before they were introduced stay the same
+type sqliteWinRow struct {
+	text       string
+	overall    int
+	priorities string
+	entries    sql.NullString
+	tags       sql.NullString
+}
+
+func (r *sqliteWinRow) fields() []interface{} {
+	return []interface{}{&r.text, &r.overall, &r.priorities, &r.entries, &r.tags}
+}
+
+func (r *sqliteWinRow) values() []interface{} {
+	return []interface{}{r.text, r.overall, r.priorities, r.entries, r.tags}
+}
+
+func encodeSqliteWin(win winData) (*sqliteWinRow, error) {
+	priorities, err := json.Marshal(win.Priorities)
+	if err != nil {
+		return nil, err
+	}
+	row := &sqliteWinRow{
+		text:       base64.StdEncoding.EncodeToString([]byte(win.Text)),
+		overall:    win.OverallResult,
+		priorities: string(priorities),
+	}
+
+	if len(win.Entries) > 0 {
+		entries, err := json.Marshal(encodeWinEntries(win.Entries))
+		if err != nil {
+			return nil, err
+		}
+		row.entries = sql.NullString{String: string(entries), Valid: true}
+	}
+	if len(win.Tags) > 0 {
+		tags, err := json.Marshal(win.Tags)
+		if err != nil {
+			return nil, err
+		}
+		row.tags = sql.NullString{String: string(tags), Valid: true}
+	}
+
+	return row, nil
+}
+
+func decodeSqliteWin(row *sqliteWinRow) (*winData, error) {
+	textBytes, err := base64.StdEncoding.DecodeString(row.text)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	var priorityIds []string
+	err = json.Unmarshal([]byte(row.priorities), &priorityIds)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+
+	var entries []winEntryData
+	if row.entries.Valid {
+		var encodedEntries []winEntryData
+		err = json.Unmarshal([]byte(row.entries.String), &encodedEntries)
+		if err != nil {
+			return nil, logAndConvertError(err)
+		}
+		entries, err = decodeWinEntries(encodedEntries)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := decodeSqliteTags(row.tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &winData{
+		Text:          string(textBytes),
+		OverallResult: row.overall,
+		Priorities:    priorityIds,
+		Entries:       entries,
+		Tags:          tags,
+	}, nil
+}
+
+func decodeSqliteTags(tags sql.NullString) ([]string, error) {
+	if !tags.Valid {
+		return nil, nil
+	}
+
+	var decoded []string
+	err := json.Unmarshal([]byte(tags.String), &decoded)
+	if err != nil {
+		return nil, logAndConvertError(err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,318 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSqliteStore(t *testing.T) Store {
+	store, err := NewSqliteStore(filepath.Join(t.TempDir(), "winaday.db"))
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	return store
+}
+
+func TestSqliteStoreWinRoundtrip(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	win := winData{
+		Text:          "Some text",
+		OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN,
+		Priorities:    []string{"001", "002"},
+	}
+
+	store.updateWin(ctx, "user", "20211001", win, "")
+	storedWin, _ := store.getWin(ctx, "user", "20211001")
+
+	assert.True(t, reflect.DeepEqual(*storedWin, win))
+}
+
+func TestSqliteStoreWinWithEntriesRoundtrip(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	win := winData{
+		Text:          "Ran\nRead",
+		OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN,
+		Priorities:    []string{"001"},
+		Entries: []winEntryData{
+			{Id: "a", Text: "Ran", Priorities: []string{"001"}, CreatedAt: "2021-10-01T10:00:00Z"},
+			{Id: "b", Text: "Read", Priorities: []string{}, CreatedAt: "2021-10-01T11:00:00Z"},
+		},
+		Tags: []string{"sport"},
+	}
+
+	store.updateWin(ctx, "user", "20211001", win, "")
+	storedWin, _ := store.getWin(ctx, "user", "20211001")
+
+	assert.True(t, reflect.DeepEqual(*storedWin, win))
+}
+
+func TestSqliteStorePatchWin(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	overallResult := OVERALL_DAY_RESULT_GOT_MY_WIN
+	text := "Ran"
+
+	created, err := store.patchWin(ctx, "user", "20211001", winPatchData{OverallResult: &overallResult}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, winData{OverallResult: overallResult, Priorities: []string{}}, *created)
+
+	store.patchWin(ctx, "user", "20211001", winPatchData{Text: &text}, "")
+	storedWin, _ := store.getWin(ctx, "user", "20211001")
+	assert.Equal(t, "Ran", storedWin.Text)
+	assert.Equal(t, overallResult, storedWin.OverallResult)
+}
+
+func TestSqliteStoreGetWinsInInterval(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211003", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	store.updateWin(ctx, "user", "20211001", winData{OverallResult: OVERALL_DAY_RESULT_COULD_NOT_GET_MY_WIN}, "")
+	store.updateWin(ctx, "user", "20211002", winData{OverallResult: OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT}, "")
+	store.updateWin(ctx, "user", "20211010", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	store.updateWin(ctx, "another user", "20211002", winData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+
+	wins, _ := store.getWins(ctx, "user", "20211001", "20211003")
+	assert.Equal(t, 3, len(wins))
+	assert.Equal(t, "20211001", wins[0].Date)
+
+	days, _ := store.getWinDays(ctx, "user", "20211001", "20211003")
+	assert.True(t, reflect.DeepEqual(days, []string{"20211002", "20211003"}))
+
+	stats, _ := store.getWinDayStats(ctx, "user", "20211001", "20211010")
+	assert.Equal(t, 4, len(stats))
+}
+
+func TestSqliteStoreGetWinsOnDates(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "First"}, "")
+	store.updateWin(ctx, "user", "20211002", winData{Text: "Skipped"}, "")
+	store.updateWin(ctx, "user", "20211003", winData{Text: "Third"}, "")
+	store.updateWin(ctx, "another user", "20211005", winData{Text: "Other"}, "")
+
+	wins, err := store.getWinsOnDates(ctx, "user", []string{"20211003", "20211001", "20211005"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(wins))
+	texts := map[string]string{}
+	for _, winOnDay := range wins {
+		texts[winOnDay.Date] = winOnDay.Win.Text
+	}
+	assert.Equal(t, map[string]string{"20211001": "First", "20211003": "Third"}, texts)
+}
+
+func TestSqliteStoreWinWritesCheckExpectedVersion(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	first := winData{Text: "Ran"}
+	store.updateWin(ctx, "user", "20211001", first, "")
+
+	err := store.updateWin(ctx, "user", "20211001", winData{Text: "Walked"}, getTestWinVersion(nil))
+	assert.Equal(t, errConflict, err)
+	err = store.updateWin(ctx, "user", "20211001", winData{Text: "Walked"}, getTestWinVersion(&first))
+	assert.Nil(t, err)
+	err = store.deleteWin(ctx, "user", "20211001", getTestWinVersion(&first))
+	assert.Equal(t, errConflict, err)
+
+	storedWin, _ := store.getWin(ctx, "user", "20211001")
+	assert.Equal(t, "Walked", storedWin.Text)
+}
+
+func TestSqliteStorePrioritiesRoundtrip(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	priorities := priorityListData{
+		Items: []priorityData{
+			{
+				Id:        "001",
+				Color:     1,
+				Text:      "One",
+				IsDeleted: false,
+			},
+		},
+	}
+
+	store.updatePriorities(ctx, "user", priorities, generateTimestamp(), "")
+	storedPriorities, _, _ := store.getPriorities(ctx, "user")
+
+	assert.True(t, reflect.DeepEqual(*storedPriorities, priorities))
+}
+
+func TestSqliteStoreDeleteAllWinsInSeveralBatches(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	for i := 1; i <= BATCH_SIZE*2+1; i++ {
+		store.updateWin(ctx, "user", fmt.Sprintf("202110%02d", i), winData{Text: "Some text"}, "")
+	}
+	store.updateWin(ctx, "another user", "20211001", winData{Text: "Some text"}, "")
+
+	err := store.deleteAllWins(ctx, "user")
+
+	assert.Nil(t, err)
+	wins, _ := store.getWins(ctx, "user", "20210101", "20221231")
+	assert.Equal(t, 0, len(wins))
+	otherWins, _ := store.getWins(ctx, "another user", "20210101", "20221231")
+	assert.Equal(t, 1, len(otherWins))
+}
+
+func TestSqliteStoreUpdateWinsInSeveralBatches(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	wins := make([]winOnDayData, 0)
+	for i := 1; i <= BATCH_SIZE+5; i++ {
+		wins = append(wins, winOnDayData{
+			Date: fmt.Sprintf("202110%02d", i),
+			Win:  winData{Text: "Some text", OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN},
+		})
+	}
+
+	written, err := store.updateWins(ctx, "user", wins)
+
+	assert.Nil(t, err)
+	assert.Equal(t, BATCH_SIZE+5, len(written))
+	stored, _ := store.getWins(ctx, "user", "20211001", "20211031")
+	assert.Equal(t, BATCH_SIZE+5, len(stored))
+}
+
+func TestSqliteStoreUpdatePrioritiesWithStaleVersion(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	priorities := priorityListData{Items: []priorityData{{Id: "001", Text: "One"}}}
+	store.updatePriorities(ctx, "user", priorities, "v1", "")
+	store.updatePriorities(ctx, "user", priorities, "v2", "v1")
+
+	err := store.updatePriorities(ctx, "user", priorities, "v3", "v1")
+
+	assert.Equal(t, errConflict, err)
+	_, version, _ := store.getPriorities(ctx, "user")
+	assert.Equal(t, "v2", version)
+}
+
+func TestSqliteStoreGetWinChanges(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Old"}, "")
+	store.updateWin(ctx, "user", "20211002", winData{Text: "Deleted"}, "")
+	since := generateTimestamp()
+	store.updateWin(ctx, "user", "20211003", winData{Text: "New"}, "")
+	store.deleteWin(ctx, "user", "20211002", "")
+	store.deleteWin(ctx, "user", "20211004", "")
+
+	changes, err := store.getWinChanges(ctx, "user", since)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, "20211003", changes[0].Date)
+	assert.Equal(t, "New", changes[0].Win.Text)
+	assert.Equal(t, "20211002", changes[1].Date)
+	assert.True(t, changes[1].Deleted)
+	wins, _ := store.getWins(ctx, "user", "20210101", "20221231")
+	assert.Equal(t, 2, len(wins))
+
+	allChanges, _ := store.getWinChanges(ctx, "user", "")
+	assert.Equal(t, 3, len(allChanges))
+}
+
+func TestSqliteStoreDeleteAllWinsDeletesTombstones(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	store.updateWin(ctx, "user", "20211001", winData{Text: "Some text"}, "")
+	store.deleteWin(ctx, "user", "20211001", "")
+
+	store.deleteAllWins(ctx, "user")
+
+	changes, _ := store.getWinChanges(ctx, "user", "")
+	assert.Equal(t, 0, len(changes))
+}
+
+func TestSqliteStoreWinVersions(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	store.addWinVersions(ctx, "user", []winVersionData{
+		{Date: "20211001", Version: "1", ReplacedAt: generateTimestamp(), Win: winData{Text: "First", Priorities: []string{}}},
+		{Date: "20211001", Version: "2", ReplacedAt: generateTimestamp(), Win: winData{Text: "Second", Priorities: []string{}}},
+		{Date: "20211002", Version: "3", ReplacedAt: generateTimestamp(), Win: winData{Text: "Other day", Priorities: []string{}}},
+	})
+
+	versions, err := store.getWinVersions(ctx, "user", "20211001", 100)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, "2", versions[0].Version)
+	assert.Equal(t, "Second", versions[0].Win.Text)
+
+	store.deleteWinVersions(ctx, "user", "20211001", []string{"2"})
+	versions, _ = store.getWinVersions(ctx, "user", "20211001", 100)
+	assert.Equal(t, 1, len(versions))
+
+	store.deleteAllWins(ctx, "user")
+	versions, _ = store.getWinVersions(ctx, "user", "20211002", 100)
+	assert.Equal(t, 0, len(versions))
+}
+
+func TestSqliteStoreDeletionRequests(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	store.saveDeletionRequest(ctx, "user", deletionRequestData{RequestedAt: "2021-10-01T00:00:00.000000000Z", PurgeAt: "2021-10-08T00:00:00.000000000Z"}, nil)
+	store.saveDeletionRequest(ctx, "another user", deletionRequestData{RequestedAt: "2021-10-05T00:00:00.000000000Z", PurgeAt: "2021-10-12T00:00:00.000000000Z"}, nil)
+
+	request, err := store.getDeletionRequest(ctx, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "2021-10-08T00:00:00.000000000Z", request.PurgeAt)
+
+	due, _ := store.getDueDeletionRequests(ctx, "2021-10-10T00:00:00.000000000Z")
+	assert.Equal(t, []deletionRequestData{{UserId: "user", RequestedAt: "2021-10-01T00:00:00.000000000Z", PurgeAt: "2021-10-08T00:00:00.000000000Z"}}, due)
+
+	store.saveDeletionRequest(ctx, "another user", deletionRequestData{
+		RequestedAt: "2021-10-05T00:00:00.000000000Z",
+		Job:         deletionJobData{Status: DELETION_STATUS_COMPLETED, Attempts: 1},
+	}, nil)
+	due, _ = store.getDueDeletionRequests(ctx, "2021-10-20T00:00:00.000000000Z")
+	assert.Equal(t, 1, len(due))
+	completed, _ := store.getDeletionRequest(ctx, "another user")
+	assert.Equal(t, deletionJobData{Status: DELETION_STATUS_COMPLETED, Attempts: 1}, completed.Job)
+
+	store.deleteDeletionRequest(ctx, "user", nil)
+	request, _ = store.getDeletionRequest(ctx, "user")
+	assert.Nil(t, request)
+}
+
+func TestSqliteStoreDeletionRequestWritesCheckExpectedRequest(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx := context.Background()
+	scheduled := deletionRequestData{RequestedAt: "2021-10-01T00:00:00.000000000Z", PurgeAt: "2021-10-08T00:00:00.000000000Z"}
+	store.saveDeletionRequest(ctx, "user", scheduled, nil)
+	started := scheduled
+	started.Job = deletionJobData{Status: DELETION_STATUS_IN_PROGRESS, Phase: "wins", Attempts: 1}
+
+	err := store.saveDeletionRequest(ctx, "user", started, &scheduled)
+	assert.Nil(t, err)
+
+	err = store.deleteDeletionRequest(ctx, "user", &scheduled)
+	assert.Equal(t, errConflict, err)
+	request, _ := store.getDeletionRequest(ctx, "user")
+	assert.Equal(t, DELETION_STATUS_IN_PROGRESS, request.Job.Status)
+
+	err = store.deleteDeletionRequest(ctx, "user", &started)
+	assert.Nil(t, err)
+	err = store.saveDeletionRequest(ctx, "user", started, &started)
+	assert.Equal(t, errConflict, err)
+}
+
+func TestSqliteStoreDeleteWinVersionsReportsTimeout(t *testing.T) {
+	store := newTestSqliteStore(t)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	err := store.deleteWinVersions(ctx, "user", "20211001", []string{"1"})
+
+	assert.Equal(t, errStorageTimeout, err)
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errStorageUnavailable = errors.New("service unavailable")
+var errStorageTimeout = errors.New("service did not respond in time")
+var errConflict = errors.New("data has been modified by another client")
+var errStorageCircuitOpen = errors.New("service temporarily unavailable")
+
+var storageTimeout = time.Duration(5) * time.Second
+
+// Store persists wins and priorities
+// DynamoDB is used in production, in-memory store is good for tests and local development
+type Store interface {
+	// When expectedVersion is not empty, only updates if the version of the stored win matches, otherwise returns errConflict
+	// The version is the one the client gets in the ETag, see getStoredWinVersion
+	updateWin(ctx context.Context, userId string, date string, win winData, expectedVersion string) error
+	// Writes several wins at once, dates are expected to be unique
+	// Returns the dates that have been written, also when it fails halfway
+	updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error)
+	// Only updates the fields present in the patch, creating the win if needed, returns the updated win
+	// Returns errConflict when text or priorities are patched on the win with entries, since they are derived from the entries
+	// Also returns errConflict when expectedVersion is not empty and does not match, the same way as updateWin
+	patchWin(ctx context.Context, userId string, date string, patch winPatchData, expectedVersion string) (*winData, error)
+	getWin(ctx context.Context, userId string, date string) (*winData, error)
+	// Returns the wins on the given dates in no particular order, skipping the dates without a win
+	// Never cached, so it can be used to read the current state before the update
+	getWinsOnDates(ctx context.Context, userId string, dates []string) ([]winOnDayData, error)
+	// Leaves the tombstone, so the deletion can be synced to other devices
+	// Does nothing when there is no win on that date
+	// When expectedVersion is not empty and does not match, returns errConflict the same way as updateWin
+	deleteWin(ctx context.Context, userId string, date string, expectedVersion string) error
+	// Returns wins [from:to]
+	getWins(ctx context.Context, userId string, from string, to string) ([]winOnDayData, error)
+	// Returns win days [from:to]
+	getWinDays(ctx context.Context, userId string, from string, to string) ([]string, error)
+	// Returns wins stats [from:to]
+	getWinDayStats(ctx context.Context, userId string, from string, to string) ([]winOnDayShortData, error)
+	// When expectedVersion is not empty, only updates if the stored version matches, otherwise returns errConflict
+	updatePriorities(ctx context.Context, userId string, priorities priorityListData, updatedAt string, expectedVersion string) error
+	// Returns priorities together with their version (the time of the last update)
+	getPriorities(ctx context.Context, userId string) (*priorityListData, string, error)
+	// Returns wins updated and deleted after since (everything when since is empty), in no particular order
+	// Every write stamps the win with the current timestamp, wins saved before that are only returned when since is empty
+	getWinChanges(ctx context.Context, userId string, since string) ([]winChangeData, error)
+	// Saves the previous versions of the wins, see historyStore
+	addWinVersions(ctx context.Context, userId string, versions []winVersionData) error
+	// Returns up to limit most recent versions of the win, the most recent first
+	getWinVersions(ctx context.Context, userId string, date string, limit int) ([]winVersionData, error)
+	deleteWinVersions(ctx context.Context, userId string, date string, versions []string) error
+	// Calls back for every win of the user, in the order of dates, stops on the first error
+	forEachWin(ctx context.Context, userId string, callback func(winOnDayData) error) error
+	// Deletes tombstones and versions as well
+	deleteAllWins(ctx context.Context, userId string) error
+	deletePriorities(ctx context.Context, userId string) error
+	// Marks the account for deletion or saves the progress of the deletion job, replacing the previous request if any
+	// When expected is not nil, only saves if the stored request is still the expected one, otherwise returns errConflict
+	saveDeletionRequest(ctx context.Context, userId string, request deletionRequestData, expected *deletionRequestData) error
+	// Returns nil when the account has never been marked for deletion
+	getDeletionRequest(ctx context.Context, userId string) (*deletionRequestData, error)
+	// Returns the requests of all users that are due to be purged at the given time, the requests without purgeAt are never due
+	getDueDeletionRequests(ctx context.Context, now string) ([]deletionRequestData, error)
+	// When expected is not nil, only deletes if the stored request is still the expected one, otherwise returns errConflict
+	deleteDeletionRequest(ctx context.Context, userId string, expected *deletionRequestData) error
+}
+
+var dataStore Store
+
+func SetStorageTimeout(timeout time.Duration) {
+	storageTimeout = timeout
+}
+
+// Every storage operation should be done within the deadline, so hung backend does not block the handlers forever
+func withStorageTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, storageTimeout)
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type streaksData struct {
+	Current streakData   `json:"current"`
+	Longest streakData   `json:"longest"`
+	History []streakData `json:"history"`
+}
+
+// Start and end are empty when there is no streak
+type streakData struct {
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Length int    `json:"length"`
+}
+
+type todayContainerData struct {
+	Today string `form:"today"`
+}
+
+func handleGetStreaks(c *gin.Context, userId string, email string) {
+	// the server does not know the user's timezone, so the client can tell what day it is
+	var todayContainer todayContainerData
+	if err := c.ShouldBindQuery(&todayContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+	today := todayContainer.Today
+	if today == "" {
+		today = time.Now().UTC().Format("20060102")
+	}
+
+	// sanitize
+	if !isDateValid(today) {
+		err := fmt.Errorf("invalid value '%s' for 'today'", today)
+		toBadRequest(c, err)
+		return
+	}
+
+	// the whole history is needed, so going through all the wins instead of the limited interval
+	winDays := []string{}
+	err := dataStore.forEachWin(c.Request.Context(), userId, func(winOnDay winOnDayData) error {
+		if isWinDay(winOnDay.Win.OverallResult) {
+			winDays = append(winDays, winOnDay.Date)
+		}
+		return nil
+	})
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toSuccessWithETag(c, getStreaks(winDays, today))
+}
+
+// Expects win days in ascending order
+// The current streak is the one that ends today or yesterday, since today may not be recorded yet
+func getStreaks(winDays []string, today string) streaksData {
+	streaks := streaksData{
+		History: []streakData{},
+	}
+
+	var streak *streakData
+	var previous time.Time
+	for _, date := range winDays {
+		d, err := time.Parse("20060102", date)
+		if err != nil {
+			continue
+		}
+
+		if streak != nil && d.Equal(previous.AddDate(0, 0, 1)) {
+			streak.End = date
+			streak.Length++
+		} else {
+			streaks.History = append(streaks.History, streakData{
+				Start:  date,
+				End:    date,
+				Length: 1,
+			})
+			streak = &streaks.History[len(streaks.History)-1]
+		}
+		previous = d
+	}
+
+	// the earliest of the longest streaks wins
+	for _, s := range streaks.History {
+		if s.Length > streaks.Longest.Length {
+			streaks.Longest = s
+		}
+	}
+
+	if len(streaks.History) > 0 {
+		last := streaks.History[len(streaks.History)-1]
+		todayDate, err := time.Parse("20060102", today)
+		if err == nil {
+			yesterday := todayDate.AddDate(0, 0, -1).Format("20060102")
+			if last.End == today || last.End == yesterday {
+				streaks.Current = last
+			}
+		}
+	}
+
+	return streaks
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStreaksNoWins(t *testing.T) {
+	streaks := getStreaks([]string{}, "20211010")
+
+	assert.Equal(t, 0, streaks.Current.Length)
+	assert.Equal(t, 0, streaks.Longest.Length)
+	assert.Equal(t, 0, len(streaks.History))
+}
+
+func TestGetStreaks(t *testing.T) {
+	winDays := []string{"20210930", "20211001", "20211002", "20211005", "20211008", "20211009"}
+
+	streaks := getStreaks(winDays, "20211010")
+
+	assert.Equal(t, 3, len(streaks.History))
+	assert.Equal(t, streakData{Start: "20210930", End: "20211002", Length: 3}, streaks.Longest)
+	assert.Equal(t, streakData{Start: "20211008", End: "20211009", Length: 2}, streaks.Current)
+}
+
+func TestGetStreaksCurrentIsBroken(t *testing.T) {
+	winDays := []string{"20211001", "20211002"}
+
+	streaks := getStreaks(winDays, "20211004")
+
+	assert.Equal(t, 0, streaks.Current.Length)
+	assert.Equal(t, 2, streaks.Longest.Length)
+}
+
+func TestGetStreaksAcrossMonthsAndYears(t *testing.T) {
+	winDays := []string{"20201231", "20210101", "20210228", "20210301"}
+
+	streaks := getStreaks(winDays, "20210301")
+
+	assert.Equal(t, 2, len(streaks.History))
+	assert.Equal(t, streakData{Start: "20201231", End: "20210101", Length: 2}, streaks.Longest)
+	assert.Equal(t, streakData{Start: "20210228", End: "20210301", Length: 2}, streaks.Current)
+}
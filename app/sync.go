@@ -0,0 +1,147 @@
+package app
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The change of the win on the date, win is empty when it was deleted
+type winChangeData struct {
+	Date      string   `json:"date"`
+	Win       *winData `json:"win,omitempty"`
+	Deleted   bool     `json:"deleted,omitempty"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+// Priorities are only sent when they changed since the token, they are always synced as a whole
+type syncData struct {
+	Token      string              `json:"token"`
+	Wins       []winChangeData     `json:"wins"`
+	Priorities *syncPrioritiesData `json:"priorities"`
+}
+
+type syncPrioritiesData struct {
+	Items     []priorityData `json:"items"`
+	UpdatedAt string         `json:"updatedAt"`
+}
+
+type sinceContainerData struct {
+	Since string `form:"since"`
+}
+
+func handleGetSync(c *gin.Context, userId string, email string) {
+	// no token means the first sync, everything is returned
+	var sinceContainer sinceContainerData
+	if err := c.ShouldBindQuery(&sinceContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// sanitize
+	since, err := decodeSyncToken(sinceContainer.Since)
+	if err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// the token is taken before reading, so nothing written in the meantime is missed
+	token := getSyncToken(time.Now())
+
+	changes, err := dataStore.getWinChanges(c.Request.Context(), userId, since)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	priorityList, version, err := dataStore.getPriorities(c.Request.Context(), userId)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	sync := syncData{
+		Token: token,
+		Wins:  getLatestWinChanges(changes),
+	}
+	if priorityList != nil && isUpdatedSince(version, since) {
+		sync.Priorities = &syncPrioritiesData{
+			Items:     priorityList.Items,
+			UpdatedAt: version,
+		}
+	}
+
+	toSuccess(c, sync)
+}
+
+// Writes are stamped right before they are sent to the storage, and they take no longer than the storage timeout,
+// so the token is moved back by the timeout, the changes committed late are returned again instead of being lost
+func getSyncToken(now time.Time) string {
+	since := formatTimestamp(now.Add(-storageTimeout))
+	return base64.RawURLEncoding.EncodeToString([]byte(since))
+}
+
+// Returns the timestamp encoded in the token, empty for the empty token
+func decodeSyncToken(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+
+	since, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		_, err = time.Parse(TIMESTAMP_FORMAT, string(since))
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid value '%s' for 'since'", token)
+	}
+	return string(since), nil
+}
+
+// Priority versions saved before the timestamps became fixed width cannot be compared as strings
+func isUpdatedSince(updatedAt string, since string) bool {
+	if since == "" {
+		return true
+	}
+
+	updatedAtTime, err := time.Parse(time.RFC3339Nano, updatedAt)
+	if err != nil {
+		return true
+	}
+	sinceTime, err := time.Parse(time.RFC3339Nano, since)
+	if err != nil {
+		return true
+	}
+	return updatedAtTime.After(sinceTime)
+}
+
+// The win saved again after it was deleted has both the change and the tombstone, only the latest one counts
+// Returned in the order of the changes, so the client can apply them one by one
+func getLatestWinChanges(changes []winChangeData) []winChangeData {
+	latestByDate := map[string]winChangeData{}
+	for _, change := range changes {
+		latest, ok := latestByDate[change.Date]
+		if !ok || change.UpdatedAt > latest.UpdatedAt {
+			latestByDate[change.Date] = change
+		}
+	}
+
+	result := make([]winChangeData, 0, len(latestByDate))
+	for _, change := range latestByDate {
+		if change.Win != nil {
+			normalized := normalizeWin(*change.Win)
+			change.Win = &normalized
+		}
+		result = append(result, change)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UpdatedAt != result[j].UpdatedAt {
+			return result[i].UpdatedAt < result[j].UpdatedAt
+		}
+		return result[i].Date < result[j].Date
+	})
+
+	return result
+}
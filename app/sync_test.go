@@ -0,0 +1,53 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTokenRoundtrip(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	since, err := decodeSyncToken(getSyncToken(now))
+
+	assert.Nil(t, err)
+	assert.Equal(t, formatTimestamp(now.Add(-storageTimeout)), since)
+}
+
+func TestInvalidSyncToken(t *testing.T) {
+	_, err := decodeSyncToken("not a token")
+	assert.NotNil(t, err)
+
+	since, err := decodeSyncToken("")
+	assert.Nil(t, err)
+	assert.Equal(t, "", since)
+}
+
+func TestIsUpdatedSinceComparesTimes(t *testing.T) {
+	since := "2021-10-01T12:00:00.000000000Z"
+
+	assert.True(t, isUpdatedSince("2021-10-01T14:30:00.5+02:00", since))
+	assert.False(t, isUpdatedSince("2021-10-01T13:30:00.5+02:00", since))
+	assert.True(t, isUpdatedSince("2021-09-01T00:00:00Z", ""))
+}
+
+func TestGetLatestWinChanges(t *testing.T) {
+	changes := []winChangeData{
+		{Date: "20211002", Win: &winData{Text: "Saved again"}, UpdatedAt: "2021-10-01T12:00:03.000000000Z"},
+		{Date: "20211001", Win: &winData{Text: "Some text"}, UpdatedAt: "2021-10-01T12:00:02.000000000Z"},
+		{Date: "20211002", Deleted: true, UpdatedAt: "2021-10-01T12:00:01.000000000Z"},
+		{Date: "20211003", Deleted: true, UpdatedAt: "2021-10-01T12:00:01.000000000Z"},
+	}
+
+	latest := getLatestWinChanges(changes)
+
+	assert.Equal(t, 3, len(latest))
+	assert.Equal(t, "20211003", latest[0].Date)
+	assert.True(t, latest[0].Deleted)
+	assert.Equal(t, "20211001", latest[1].Date)
+	assert.Equal(t, []string{}, latest[1].Win.Priorities)
+	assert.Equal(t, "20211002", latest[2].Date)
+	assert.Equal(t, "Saved again", latest[2].Win.Text)
+}
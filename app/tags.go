@@ -0,0 +1,54 @@
+package app
+
+import (
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tagListData struct {
+	Items []tagUsageData `json:"items"`
+}
+
+type tagUsageData struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func handleGetTags(c *gin.Context, userId string, email string) {
+	// tags are not stored separately, so going through all the wins
+	countsByTag := map[string]int{}
+	err := dataStore.forEachWin(c.Request.Context(), userId, func(winOnDay winOnDayData) error {
+		for _, tag := range winOnDay.Win.Tags {
+			countsByTag[tag]++
+		}
+		return nil
+	})
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toSuccessWithETag(c, getTagList(countsByTag))
+}
+
+// The most used tags first
+func getTagList(countsByTag map[string]int) tagListData {
+	tagList := tagListData{
+		Items: make([]tagUsageData, 0, len(countsByTag)),
+	}
+	for tag, count := range countsByTag {
+		tagList.Items = append(tagList.Items, tagUsageData{
+			Tag:   tag,
+			Count: count,
+		})
+	}
+	sort.Slice(tagList.Items, func(i, j int) bool {
+		if tagList.Items[i].Count != tagList.Items[j].Count {
+			return tagList.Items[i].Count > tagList.Items[j].Count
+		}
+		return tagList.Items[i].Tag < tagList.Items[j].Tag
+	})
+
+	return tagList
+}
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTagList(t *testing.T) {
+	tagList := getTagList(map[string]int{"work": 2, "family": 5, "art": 2})
+
+	assert.Equal(t, []tagUsageData{
+		{Tag: "family", Count: 5},
+		{Tag: "art", Count: 2},
+		{Tag: "work", Count: 2},
+	}, tagList.Items)
+}
+
+func TestWinTagsAreValidated(t *testing.T) {
+	assert.Nil(t, validateWin("20211001", winData{Tags: []string{"work", "family"}}))
+	assert.NotNil(t, validateWin("20211001", winData{Tags: []string{"work", "work"}}))
+	assert.NotNil(t, validateWin("20211001", winData{Tags: []string{""}}))
+}
@@ -7,6 +7,10 @@ import (
 const (
 	WIN_TEXT_MAX_LENGTH     = 2000
 	WIN_PRIORITIES_MAX_SIZE = 100
+	WIN_ENTRIES_MAX_SIZE    = 20
+	WIN_TAGS_MAX_SIZE       = 20
+
+	TAG_MAX_LENGTH = 50
 
 	PRIORITY_ID_MAX_LENGTH   = 100
 	PRIORITY_TEXT_MAX_LENGTH = 100
@@ -17,6 +21,8 @@ const (
 	WINS_INTERVAL_REQUESTED_MAX_DAYS     = 50
 	WIN_DAYS_INTERVAL_REQUESTED_MAX_DAYS = 50
 	STATS_INTERVAL_REQUESTED_MAX_DAYS    = 400
+
+	WINS_BATCH_MAX_SIZE = 100
 )
 
 func isUserIdValid(userId string) bool {
@@ -71,6 +77,26 @@ func isWinPriorityListValid(priorities []string) bool {
 	return true
 }
 
+func isWinTagListValid(tags []string) bool {
+	if len(tags) > WIN_TAGS_MAX_SIZE {
+		return false
+	}
+
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		if !isTagValid(tag) || seen[tag] {
+			return false
+		}
+		seen[tag] = true
+	}
+
+	return true
+}
+
+func isTagValid(tag string) bool {
+	return tag != "" && len(tag) <= TAG_MAX_LENGTH
+}
+
 func isPriorityListLengthValid(priorities priorityListData) bool {
 	active := 0
 	total := 0
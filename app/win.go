@@ -1,7 +1,11 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +19,18 @@ type dateIntervalContainerData struct {
 	To   string `uri:"to" binding:"required"`
 }
 
+type tagContainerData struct {
+	Tag string `form:"tag"`
+}
+
+// Fields that are nil are not updated
+type winPatchData struct {
+	Text          *string
+	OverallResult *int
+	Priorities    *[]string
+	Tags          *[]string
+}
+
 type winListData struct {
 	Items []winOnDayData `json:"items"`
 }
@@ -24,19 +40,19 @@ type winOnDayData struct {
 	Win  winData `json:"win"`
 }
 
+// When the win has entries, text and priorities are derived from them
 type winData struct {
-	Text          string   `json:"text"`
-	OverallResult int      `json:"overall"`
-	Priorities    []string `json:"priorities"`
+	Text          string         `json:"text"`
+	OverallResult int            `json:"overall"`
+	Priorities    []string       `json:"priorities"`
+	Entries       []winEntryData `json:"entries"`
+	Tags          []string       `json:"tags"`
 }
 
 type winDayListData struct {
 	Items []string `json:"items"`
 }
 
-type deleteAllResponseData struct {
-}
-
 func handleGetWin(c *gin.Context, userId string, email string) {
 	// get date from URL
 	var dateContainer dateContainerData
@@ -45,12 +61,33 @@ func handleGetWin(c *gin.Context, userId string, email string) {
 		return
 	}
 
-	win, err := getWin(userId, dateContainer.Date)
+	win, err := getWinOrEmpty(c.Request.Context(), userId, dateContainer.Date)
 	if err != nil {
-		toInternalServerError(c, err.Error())
+		toStorageError(c, err)
 		return
 	}
 
+	// TODO: this is for testing, remove when no more useful
+	/*time.Sleep(300 * time.Millisecond)
+	toBadRequest(c, fmt.Errorf("Something went wrong returning win"))
+	return*/
+
+	toSuccessWithETag(c, win)
+}
+
+// Returns the win exactly the way it is sent to the client, so the ETags can be compared
+func getWinOrEmpty(ctx context.Context, userId string, date string) (*winData, error) {
+	win, err := dataStore.getWin(ctx, userId, date)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := normalizeWinOrEmpty(win)
+	return &normalized, nil
+}
+
+// The missing win is sent to the client as the empty one
+func normalizeWinOrEmpty(win *winData) winData {
 	if win == nil {
 		win = &winData{
 			Text:          "",
@@ -58,17 +95,55 @@ func handleGetWin(c *gin.Context, userId string, email string) {
 			Priorities:    []string{},
 		}
 	}
+	return normalizeWin(*win)
+}
 
-	if win.Priorities == nil {
-		win.Priorities = []string{}
+// Lets the store compare the stored win (nil when missing) with the version the client got in the ETag
+// Returns errConflict when they differ, any version matches when none is expected
+func checkStoredWinVersion(stored *winData, expectedVersion string) error {
+	if expectedVersion == "" {
+		return nil
 	}
 
-	// TODO: this is for testing, remove when no more useful
-	/*time.Sleep(300 * time.Millisecond)
-	toBadRequest(c, fmt.Errorf("Something went wrong returning win"))
-	return*/
+	version, err := getStoredWinVersion(stored)
+	if err != nil {
+		return err
+	}
+	if version != expectedVersion {
+		return errConflict
+	}
+	return nil
+}
 
-	toSuccess(c, win)
+// The version the client gets in the ETag for the stored win (nil when missing)
+func getStoredWinVersion(stored *winData) (string, error) {
+	normalized := normalizeWinOrEmpty(stored)
+	_, version, err := getDataVersion(&normalized)
+	if err != nil {
+		return "", logAndConvertError(err)
+	}
+	return version, nil
+}
+
+// Makes a copy the way it is sent to the client: no nulls and the wins saved before entries were introduced
+// presented as a single entry
+func normalizeWin(win winData) winData {
+	normalized := copyWin(win)
+	if normalized.Priorities == nil {
+		normalized.Priorities = []string{}
+	}
+	if normalized.Tags == nil {
+		normalized.Tags = []string{}
+	}
+
+	normalized.Entries = getWinEntries(normalized)
+	for i := range normalized.Entries {
+		if normalized.Entries[i].Priorities == nil {
+			normalized.Entries[i].Priorities = []string{}
+		}
+	}
+
+	return normalized
 }
 
 func handlePostWin(c *gin.Context, userId string, email string) {
@@ -86,44 +161,320 @@ func handlePostWin(c *gin.Context, userId string, email string) {
 		return
 	}
 
+	// entries sent without ids are the new ones
+	win = prepareWinEntries(win, generateTimestamp())
+
 	// sanitize
-	if !isDateValid(dateContainer.Date) {
-		err := fmt.Errorf("invalid value '%s' for 'date'", dateContainer.Date)
+	if err := validateWin(dateContainer.Date, win); err != nil {
 		toBadRequest(c, err)
 		return
 	}
-	if !isWinTextValid(win.Text) {
-		err := fmt.Errorf("invalid value '%s' for 'text', should be less than %d characters long",
-			win.Text,
-			WIN_TEXT_MAX_LENGTH)
+
+	// make sure the client is not overwriting the entry modified from another device
+	err := dataStore.updateWin(c.Request.Context(), userId, dateContainer.Date, win, getIfMatchVersion(c))
+	if err == errConflict {
+		toWinVersionConflict(c, userId, dateContainer.Date)
+		return
+	}
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	/*toBadRequest(c, fmt.Errorf("Something went wrong returning win list"))
+	return*/
+
+	toWinSuccess(c, http.StatusOK, win)
+}
+
+// Accepts JSON merge patch over text, overall, priorities and tags
+func handlePatchWin(c *gin.Context, userId string, email string) {
+	// get date from URL
+	var dateContainer dateContainerData
+	if err := c.ShouldBindUri(&dateContainer); err != nil {
 		toBadRequest(c, err)
 		return
 	}
-	if !isWinOverallResultValid(win.OverallResult) {
-		err := fmt.Errorf("invalid value '%s' for 'overall', should be a number in [0:4] range",
-			win.Text)
+
+	// get patch from the PATCH body
+	body, err := c.GetRawData()
+	if err != nil {
 		toBadRequest(c, err)
 		return
 	}
-	if !isWinPriorityListValid(win.Priorities) {
-		err := fmt.Errorf("invalid value '%s' for 'priorities', max %d items allowed, non-empty and less than %d characters long",
-			win.Text,
+	patch, err := parseWinPatch(body)
+	if err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// sanitize
+	if err := validateWinPatch(dateContainer.Date, patch); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// make sure the client is not overwriting the entry modified from another device
+	win, err := dataStore.patchWin(c.Request.Context(), userId, dateContainer.Date, patch, getIfMatchVersion(c))
+	if err == errConflict {
+		currentWin, err := getWinOrEmpty(c.Request.Context(), userId, dateContainer.Date)
+		if err != nil {
+			toStorageError(c, err)
+			return
+		}
+		if !checkWinVersion(c, currentWin) {
+			return
+		}
+		// the version matches, so text and priorities of the day with entries can only be changed through the entries
+		toConflict(c, "the win has entries, update 'text' and 'priorities' through the entries", currentWin)
+		return
+	}
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toWinSuccess(c, http.StatusOK, *win)
+}
+
+func handleDeleteWin(c *gin.Context, userId string, email string) {
+	// get date from URL
+	var dateContainer dateContainerData
+	if err := c.ShouldBindUri(&dateContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// sanitize
+	if !isDateValid(dateContainer.Date) {
+		err := fmt.Errorf("invalid value '%s' for 'date'", dateContainer.Date)
+		toBadRequest(c, err)
+		return
+	}
+
+	// make sure the client is not deleting the entry modified from another device
+	err := dataStore.deleteWin(c.Request.Context(), userId, dateContainer.Date, getIfMatchVersion(c))
+	if err == errConflict {
+		toWinVersionConflict(c, userId, dateContainer.Date)
+		return
+	}
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toNoContent(c)
+}
+
+// JSON merge patch: the fields that are not present are not changed, null resets the field
+func parseWinPatch(body []byte) (winPatchData, error) {
+	var patch winPatchData
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return patch, err
+	}
+
+	for name, value := range fields {
+		isNull := string(value) == "null"
+		var err error
+		switch name {
+		case "text":
+			text := ""
+			if !isNull {
+				err = json.Unmarshal(value, &text)
+			}
+			patch.Text = &text
+		case "overall":
+			overallResult := OVERALL_DAY_RESULT_NO_WIN_YET
+			if !isNull {
+				err = json.Unmarshal(value, &overallResult)
+			}
+			patch.OverallResult = &overallResult
+		case "priorities":
+			priorities := []string{}
+			if !isNull {
+				err = json.Unmarshal(value, &priorities)
+			}
+			patch.Priorities = &priorities
+		case "tags":
+			tags := []string{}
+			if !isNull {
+				err = json.Unmarshal(value, &tags)
+			}
+			patch.Tags = &tags
+		default:
+			err = fmt.Errorf("field '%s' cannot be patched, only 'text', 'overall', 'priorities' and 'tags' can", name)
+		}
+		if err != nil {
+			return patch, err
+		}
+	}
+
+	return patch, nil
+}
+
+func validateWinPatch(date string, patch winPatchData) error {
+	if !isDateValid(date) {
+		return fmt.Errorf("invalid value '%s' for 'date'", date)
+	}
+	if patch.Text != nil && !isWinTextValid(*patch.Text) {
+		return fmt.Errorf("invalid value '%s' for 'text', should be less than %d characters long",
+			*patch.Text,
+			WIN_TEXT_MAX_LENGTH)
+	}
+	if patch.OverallResult != nil && !isWinOverallResultValid(*patch.OverallResult) {
+		return fmt.Errorf("invalid value '%d' for 'overall', should be a number in [0:4] range",
+			*patch.OverallResult)
+	}
+	if patch.Priorities != nil && !isWinPriorityListValid(*patch.Priorities) {
+		return fmt.Errorf("invalid value '%s' for 'priorities', max %d items allowed, non-empty and less than %d characters long",
+			strings.Join(*patch.Priorities, ", "),
 			WIN_PRIORITIES_MAX_SIZE,
 			PRIORITY_ID_MAX_LENGTH)
-		toBadRequest(c, err)
+	}
+	if patch.Tags != nil && !isWinTagListValid(*patch.Tags) {
+		return fmt.Errorf("invalid value '%s' for 'tags', max %d unique items allowed, non-empty and not longer than %d characters",
+			strings.Join(*patch.Tags, ", "),
+			WIN_TAGS_MAX_SIZE,
+			TAG_MAX_LENGTH)
+	}
+
+	return nil
+}
+
+// Returns false and responds with 412 and the current copy when the client has seen a different version
+func checkWinVersion(c *gin.Context, currentWin *winData) bool {
+	expectedVersion := getIfMatchVersion(c)
+	if expectedVersion == "" {
+		return true
+	}
+
+	_, currentVersion, err := getDataVersion(currentWin)
+	if err != nil {
+		toInternalServerError(c, err.Error())
+		return false
+	}
+	if currentVersion != expectedVersion {
+		setETag(c, currentVersion)
+		toPreconditionFailed(c, errConflict.Error(), currentWin)
+		return false
+	}
+
+	return true
+}
+
+// Responds with 412 and the current copy when the storage refused the write, since the win is no longer the version the client has seen
+func toWinVersionConflict(c *gin.Context, userId string, date string) {
+	currentWin, err := getWinOrEmpty(c.Request.Context(), userId, date)
+	if err != nil {
+		toStorageError(c, err)
 		return
 	}
+	_, currentVersion, err := getDataVersion(currentWin)
+	if err != nil {
+		toInternalServerError(c, err.Error())
+		return
+	}
+	setETag(c, currentVersion)
+	toPreconditionFailed(c, errConflict.Error(), currentWin)
+}
 
-	err := updateWin(userId, dateContainer.Date, win)
+// Responds with the updated win and its ETag, so the client can send it with the next update
+func toWinSuccess(c *gin.Context, status int, win winData) {
+	normalized := normalizeWin(win)
+	_, version, err := getDataVersion(&normalized)
 	if err != nil {
 		toInternalServerError(c, err.Error())
 		return
 	}
+	setETag(c, version)
+	c.JSON(status, gin.H{"data": normalized})
+}
 
-	/*toBadRequest(c, fmt.Errorf("Something went wrong returning win list"))
-	return*/
+// Applies the patch the same way the storage does, for the stores that cannot do it in a single update
+func applyWinPatch(win winData, patch winPatchData) (winData, error) {
+	if len(win.Entries) > 0 && (patch.Text != nil || patch.Priorities != nil) {
+		return win, errConflict
+	}
+
+	patched := copyWin(win)
+	if patch.Text != nil {
+		patched.Text = *patch.Text
+	}
+	if patch.OverallResult != nil {
+		patched.OverallResult = *patch.OverallResult
+	}
+	if patch.Priorities != nil {
+		patched.Priorities = nonNilStrings(*patch.Priorities)
+	}
+	if patch.Tags != nil {
+		patched.Tags = nil
+		if len(*patch.Tags) > 0 {
+			patched.Tags = *patch.Tags
+		}
+	}
+
+	return patched, nil
+}
+
+func nonNilStrings(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
+
+func isWinDay(overallResult int) bool {
+	return overallResult == OVERALL_DAY_RESULT_GOT_MY_WIN ||
+		overallResult == OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT
+}
+
+func validateWin(date string, win winData) error {
+	if !isDateValid(date) {
+		return fmt.Errorf("invalid value '%s' for 'date'", date)
+	}
+	if !isWinOverallResultValid(win.OverallResult) {
+		return fmt.Errorf("invalid value '%s' for 'overall', should be a number in [0:4] range",
+			win.Text)
+	}
+	if !isWinTagListValid(win.Tags) {
+		return fmt.Errorf("invalid value '%s' for 'tags', max %d unique items allowed, non-empty and not longer than %d characters",
+			strings.Join(win.Tags, ", "),
+			WIN_TAGS_MAX_SIZE,
+			TAG_MAX_LENGTH)
+	}
+
+	// text and priorities are derived from the entries, so they are validated per entry first,
+	// and then together, since the day is stored and sent with the same limits as the win without entries
+	if len(win.Entries) > 0 {
+		if err := validateWinEntries(win.Entries); err != nil {
+			return err
+		}
+		if !isWinTextValid(win.Text) {
+			return fmt.Errorf("too much text in the entries, should be less than %d characters long together",
+				WIN_TEXT_MAX_LENGTH)
+		}
+		if !isWinPriorityListValid(win.Priorities) {
+			return fmt.Errorf("too many priorities in the entries, max %d different items allowed together",
+				WIN_PRIORITIES_MAX_SIZE)
+		}
+		return nil
+	}
 
-	toSuccess(c, win)
+	if !isWinTextValid(win.Text) {
+		return fmt.Errorf("invalid value '%s' for 'text', should be less than %d characters long",
+			win.Text,
+			WIN_TEXT_MAX_LENGTH)
+	}
+	if !isWinPriorityListValid(win.Priorities) {
+		return fmt.Errorf("invalid value '%s' for 'priorities', max %d items allowed, non-empty and less than %d characters long",
+			win.Text,
+			WIN_PRIORITIES_MAX_SIZE,
+			PRIORITY_ID_MAX_LENGTH)
+	}
+
+	return nil
 }
 
 func handleGetWins(c *gin.Context, userId string, email string) {
@@ -134,6 +485,13 @@ func handleGetWins(c *gin.Context, userId string, email string) {
 		return
 	}
 
+	// get optional tag filter from the query string
+	var tagContainer tagContainerData
+	if err := c.ShouldBindQuery(&tagContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
 	// sanitize
 	if !isDateValid(dateIntervalContainer.From) {
 		err := fmt.Errorf("invalid value '%s' for 'from'", dateIntervalContainer.From)
@@ -157,20 +515,24 @@ func handleGetWins(c *gin.Context, userId string, email string) {
 		return
 	}
 
-	wins, err := getWins(userId, dateIntervalContainer.From, dateIntervalContainer.To)
+	wins, err := dataStore.getWins(c.Request.Context(), userId, dateIntervalContainer.From, dateIntervalContainer.To)
 	if err != nil {
-		toInternalServerError(c, err.Error())
+		toStorageError(c, err)
 		return
 	}
 
+	// the stored wins may be shared with the cache, so they are copied
+	winList := winListData{
+		Items: make([]winOnDayData, 0, len(wins)),
+	}
 	for _, winOnDay := range wins {
-		if winOnDay.Win.Priorities == nil {
-			winOnDay.Win.Priorities = []string{}
+		if tagContainer.Tag != "" && !containsString(winOnDay.Win.Tags, tagContainer.Tag) {
+			continue
 		}
-	}
-
-	winList := winListData{
-		Items: wins,
+		winList.Items = append(winList.Items, winOnDayData{
+			Date: winOnDay.Date,
+			Win:  normalizeWin(winOnDay.Win),
+		})
 	}
 
 	// TODO: this is for testing, remove when no more useful
@@ -178,7 +540,7 @@ func handleGetWins(c *gin.Context, userId string, email string) {
 	toBadRequest(c, fmt.Errorf("Something went wrong returning win list"))
 	return*/
 
-	toSuccess(c, winList)
+	toSuccessWithETag(c, winList)
 }
 
 func handleGetWinDays(c *gin.Context, userId string, email string) {
@@ -212,9 +574,9 @@ func handleGetWinDays(c *gin.Context, userId string, email string) {
 		return
 	}
 
-	winDays, err := getWinDays(userId, dateIntervalContainer.From, dateIntervalContainer.To)
+	winDays, err := dataStore.getWinDays(c.Request.Context(), userId, dateIntervalContainer.From, dateIntervalContainer.To)
 	if err != nil {
-		toInternalServerError(c, err.Error())
+		toStorageError(c, err)
 		return
 	}
 
@@ -228,24 +590,5 @@ func handleGetWinDays(c *gin.Context, userId string, email string) {
 	return*/
 
 	//time.Sleep(2000 * time.Millisecond)
-	toSuccess(c, winDayList)
-}
-
-func handlePostDeleteAllData(c *gin.Context, userId string, email string) {
-	err := deleteAllWins(userId)
-	if err != nil {
-		toInternalServerError(c, err.Error())
-		return
-	}
-
-	err = deletePriorities(userId)
-	if err != nil {
-		toInternalServerError(c, err.Error())
-		return
-	}
-
-	/*toBadRequest(c, fmt.Errorf("Something went wrong returning win list"))
-	return*/
-
-	toSuccess(c, deleteAllResponseData{})
+	toSuccessWithETag(c, winDayList)
 }
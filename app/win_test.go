@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWinPatch(t *testing.T) {
+	patch, err := parseWinPatch([]byte(`{"overall": 4, "text": null}`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, *patch.OverallResult)
+	assert.Equal(t, "", *patch.Text)
+	assert.Nil(t, patch.Priorities)
+	assert.Nil(t, patch.Tags)
+}
+
+func TestParseWinPatchWithUnknownField(t *testing.T) {
+	_, err := parseWinPatch([]byte(`{"entries": []}`))
+
+	assert.NotNil(t, err)
+}
+
+func TestPatchWinKeepsFieldsNotInPatch(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	dataStore.updateWin(context.Background(), "user", "20211001", winData{Text: "Ran", Priorities: []string{"001"}}, "")
+	params := gin.Params{{Key: "dt", Value: "20211001"}}
+
+	code, win := callWinHandler(handlePatchWin, "PATCH", params, `{"overall": 4}`)
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "Ran", win.Text)
+	assert.Equal(t, []string{"001"}, win.Priorities)
+	assert.Equal(t, OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT, win.OverallResult)
+}
+
+func TestPatchWinIsValidated(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	params := gin.Params{{Key: "dt", Value: "20211001"}}
+
+	code, _ := callWinHandler(handlePatchWin, "PATCH", params, `{"overall": 7}`)
+
+	assert.Equal(t, 400, code)
+}
+
+func TestPatchWinTextWithEntriesIsConflict(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	params := gin.Params{{Key: "dt", Value: "20211001"}}
+	callWinHandler(handlePostWinEntry, "POST", params, `{"text": "Ran"}`)
+
+	code, win := callWinHandler(handlePatchWin, "PATCH", params, `{"text": "Walked"}`)
+
+	assert.Equal(t, 409, code)
+	assert.Equal(t, "Ran", win.Text)
+}
+
+func TestDeleteWin(t *testing.T) {
+	ctx := context.Background()
+	dataStore = NewInMemoryStore()
+	dataStore.updateWin(ctx, "user", "20211001", winData{Text: "Ran", OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	dataStore.updateWin(ctx, "user", "20211002", winData{Text: "Read", OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN}, "")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("DELETE", "/win/20211002", nil)
+	c.Params = gin.Params{{Key: "dt", Value: "20211002"}}
+
+	handleDeleteWin(c, "user", "user@example.com")
+
+	assert.Equal(t, 204, c.Writer.Status())
+	days, _ := dataStore.getWinDays(ctx, "user", "20211001", "20211031")
+	assert.Equal(t, []string{"20211001"}, days)
+	win, _ := dataStore.getWin(ctx, "user", "20211002")
+	assert.Nil(t, win)
+}
+
+func getTestWinVersion(win *winData) string {
+	normalized := normalizeWinOrEmpty(win)
+	_, version, _ := getDataVersion(&normalized)
+	return version
+}
+
+func TestWinWritesCheckExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore()
+	emptyVersion := getTestWinVersion(nil)
+	first := winData{Text: "Ran"}
+
+	assert.Nil(t, store.updateWin(ctx, "user", "20211001", first, emptyVersion))
+	assert.Equal(t, errConflict, store.updateWin(ctx, "user", "20211001", winData{Text: "Walked"}, emptyVersion))
+	_, err := store.patchWin(ctx, "user", "20211001", winPatchData{Tags: &[]string{"sport"}}, emptyVersion)
+	assert.Equal(t, errConflict, err)
+	assert.Equal(t, errConflict, store.deleteWin(ctx, "user", "20211001", emptyVersion))
+
+	assert.Nil(t, store.deleteWin(ctx, "user", "20211001", getTestWinVersion(&first)))
+	win, _ := store.getWin(ctx, "user", "20211001")
+	assert.Nil(t, win)
+}
+
+func TestPostWinOverDifferentVersionIsPreconditionFailed(t *testing.T) {
+	ctx := context.Background()
+	dataStore = NewInMemoryStore()
+	dataStore.updateWin(ctx, "user", "20211001", winData{Text: "Ran"}, "")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/win/20211001", strings.NewReader(`{"text": "Walked", "overall": 1}`))
+	c.Request.Header.Set("If-Match", toETag(getTestWinVersion(nil)))
+	c.Params = gin.Params{{Key: "dt", Value: "20211001"}}
+
+	handlePostWin(c, "user", "user@example.com")
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	stored, _ := dataStore.getWin(ctx, "user", "20211001")
+	assert.Equal(t, "Ran", stored.Text)
+	current, _ := getWinOrEmpty(ctx, "user", "20211001")
+	assert.Equal(t, toETag(getTestWinVersion(current)), w.Header().Get("ETag"))
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+type winBatchResultListData struct {
+	Items []winBatchResultData `json:"items"`
+}
+
+type winBatchResultData struct {
+	Date    string `json:"date"`
+	Success bool   `json:"success"`
+	Err     string `json:"err,omitempty"`
+}
+
+// Saves the edits queued by the client while offline, the wins are saved as a whole, same as with POST /win/:dt
+// When the same date comes several times, the last one wins, since it is the latest edit
+func handlePostWinBatch(c *gin.Context, userId string, email string) {
+	// get wins from the POST body
+	var winList winListData
+	if err := c.ShouldBindJSON(&winList); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// sanitize
+	if len(winList.Items) > WINS_BATCH_MAX_SIZE {
+		err := fmt.Errorf("too many items in a batch, max %d allowed", WINS_BATCH_MAX_SIZE)
+		toBadRequest(c, err)
+		return
+	}
+
+	wins, results := getWinsToSave(winList.Items, generateTimestamp())
+
+	// when the storage fails halfway, the client is told which wins to send again
+	written, err := dataStore.updateWins(c.Request.Context(), userId, wins)
+	if err != nil && len(written) == 0 {
+		toStorageError(c, err)
+		return
+	}
+
+	toSuccess(c, setWinBatchResults(results, written))
+}
+
+// Returns valid wins to save and the result for every date, the valid ones only succeed once saved
+func getWinsToSave(items []winOnDayData, createdAt string) ([]winOnDayData, winBatchResultListData) {
+	lastIndexByDate := map[string]int{}
+	for i, winOnDay := range items {
+		lastIndexByDate[winOnDay.Date] = i
+	}
+
+	wins := make([]winOnDayData, 0, len(lastIndexByDate))
+	results := winBatchResultListData{
+		Items: make([]winBatchResultData, 0, len(lastIndexByDate)),
+	}
+	for i, winOnDay := range items {
+		if lastIndexByDate[winOnDay.Date] != i {
+			continue
+		}
+
+		winOnDay.Win = prepareWinEntries(winOnDay.Win, createdAt)
+		if err := validateWin(winOnDay.Date, winOnDay.Win); err != nil {
+			results.Items = append(results.Items, winBatchResultData{
+				Date: winOnDay.Date,
+				Err:  err.Error(),
+			})
+			continue
+		}
+
+		wins = append(wins, winOnDay)
+		results.Items = append(results.Items, winBatchResultData{
+			Date: winOnDay.Date,
+		})
+	}
+
+	return wins, results
+}
+
+// Marks the written wins as saved, the valid ones that have not been written as failed
+func setWinBatchResults(results winBatchResultListData, written []string) winBatchResultListData {
+	isWritten := map[string]bool{}
+	for _, date := range written {
+		isWritten[date] = true
+	}
+
+	for i, result := range results.Items {
+		if result.Err != "" {
+			continue
+		}
+		if isWritten[result.Date] {
+			results.Items[i].Success = true
+		} else {
+			results.Items[i].Err = "not saved because of a storage failure, try again"
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func postWinBatch(body string) (int, winBatchResultListData) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/wins/batch", strings.NewReader(body))
+
+	handlePostWinBatch(c, "user", "user@example.com")
+
+	var response struct {
+		Data winBatchResultListData `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.Data
+}
+
+func TestPostWinBatch(t *testing.T) {
+	ctx := context.Background()
+	dataStore = NewInMemoryStore()
+
+	code, results := postWinBatch(`{"items": [
+		{"date": "20211001", "win": {"text": "Ran", "overall": 1}},
+		{"date": "20211002", "win": {"text": "Bad overall", "overall": 7}},
+		{"date": "20211001", "win": {"text": "Ran 10k", "overall": 4}}
+	]}`)
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 2, len(results.Items))
+	assert.Equal(t, "20211002", results.Items[0].Date)
+	assert.False(t, results.Items[0].Success)
+	assert.NotEqual(t, "", results.Items[0].Err)
+	assert.Equal(t, winBatchResultData{Date: "20211001", Success: true}, results.Items[1])
+
+	win, _ := dataStore.getWin(ctx, "user", "20211001")
+	assert.Equal(t, "Ran 10k", win.Text)
+	win, _ = dataStore.getWin(ctx, "user", "20211002")
+	assert.Nil(t, win)
+}
+
+// Writes the first half of the wins, then fails
+type halfFailingStore struct {
+	Store
+}
+
+func (s *halfFailingStore) updateWins(ctx context.Context, userId string, wins []winOnDayData) ([]string, error) {
+	written, _ := s.Store.updateWins(ctx, userId, wins[:len(wins)/2])
+	return written, errStorageUnavailable
+}
+
+func TestPostWinBatchReportsWinsNotSaved(t *testing.T) {
+	dataStore = &halfFailingStore{Store: NewInMemoryStore()}
+
+	code, results := postWinBatch(`{"items": [
+		{"date": "20211001", "win": {"text": "Ran", "overall": 1}},
+		{"date": "20211002", "win": {"text": "Walked", "overall": 1}}
+	]}`)
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, winBatchResultData{Date: "20211001", Success: true}, results.Items[0])
+	assert.False(t, results.Items[1].Success)
+	assert.NotEqual(t, "", results.Items[1].Err)
+}
+
+func TestPostWinBatchFailsWhenNothingIsSaved(t *testing.T) {
+	dataStore = &halfFailingStore{Store: NewInMemoryStore()}
+
+	code, _ := postWinBatch(`{"items": [{"date": "20211001", "win": {"text": "Ran", "overall": 1}}]}`)
+
+	assert.Equal(t, 500, code)
+}
+
+func TestPostWinBatchTooLarge(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	items := make([]string, WINS_BATCH_MAX_SIZE+1)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"date": "2021%04d", "win": {"text": "Ran", "overall": 1}}`, i)
+	}
+
+	code, _ := postWinBatch(`{"items": [` + strings.Join(items, ",") + `]}`)
+
+	assert.Equal(t, 400, code)
+}
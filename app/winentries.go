@@ -0,0 +1,271 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The win saved before entries were introduced is presented as a single entry with this id,
+// it is persisted as an entry the first time the entries of that day are updated
+const WIN_LEGACY_ENTRY_ID = "legacy"
+
+type winEntryData struct {
+	Id         string   `json:"id"`
+	Text       string   `json:"text"`
+	Priorities []string `json:"priorities"`
+	CreatedAt  string   `json:"createdAt"`
+}
+
+type winEntryContainerData struct {
+	Date string `uri:"dt" binding:"required"`
+	Id   string `uri:"id" binding:"required"`
+}
+
+// Only the fields that are present are updated
+// The day overall result can be set alongside the entry
+type winEntryUpdateData struct {
+	Text          *string   `json:"text"`
+	Priorities    *[]string `json:"priorities"`
+	OverallResult *int      `json:"overall"`
+}
+
+func handlePostWinEntry(c *gin.Context, userId string, email string) {
+	// get date from URL
+	var dateContainer dateContainerData
+	if err := c.ShouldBindUri(&dateContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// get entry data from the POST body
+	var update winEntryUpdateData
+	if err := c.ShouldBindJSON(&update); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	id, err := generateWinEntryId()
+	if err != nil {
+		toInternalServerError(c, err.Error())
+		return
+	}
+	entry := winEntryData{
+		Id:         id,
+		Priorities: []string{},
+		CreatedAt:  generateTimestamp(),
+	}
+
+	updateWinEntry(c, userId, dateContainer.Date, http.StatusCreated, update.OverallResult, func(win *winData) bool {
+		applyWinEntryUpdate(&entry, update)
+		win.Entries = append(win.Entries, entry)
+
+		// adding a win means the day has a win, unless told otherwise
+		if update.OverallResult == nil && win.OverallResult == OVERALL_DAY_RESULT_NO_WIN_YET {
+			win.OverallResult = OVERALL_DAY_RESULT_GOT_MY_WIN
+		}
+		return true
+	})
+}
+
+func handlePatchWinEntry(c *gin.Context, userId string, email string) {
+	// get date and entry id from URL
+	var entryContainer winEntryContainerData
+	if err := c.ShouldBindUri(&entryContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// get entry data from the PATCH body
+	var update winEntryUpdateData
+	if err := c.ShouldBindJSON(&update); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	updateWinEntry(c, userId, entryContainer.Date, http.StatusOK, update.OverallResult, func(win *winData) bool {
+		for i := range win.Entries {
+			if win.Entries[i].Id == entryContainer.Id {
+				applyWinEntryUpdate(&win.Entries[i], update)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func handleDeleteWinEntry(c *gin.Context, userId string, email string) {
+	// get date and entry id from URL
+	var entryContainer winEntryContainerData
+	if err := c.ShouldBindUri(&entryContainer); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	updateWinEntry(c, userId, entryContainer.Date, http.StatusOK, nil, func(win *winData) bool {
+		for i := range win.Entries {
+			if win.Entries[i].Id == entryContainer.Id {
+				win.Entries = append(win.Entries[:i], win.Entries[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Reads the day, applies the change to its entries and saves the whole day back
+// change returns false when the entry is not found, overallResult is only set when not nil
+func updateWinEntry(c *gin.Context, userId string, date string, status int, overallResult *int, change func(win *winData) bool) {
+	// sanitize
+	if !isDateValid(date) {
+		err := fmt.Errorf("invalid value '%s' for 'date'", date)
+		toBadRequest(c, err)
+		return
+	}
+
+	win, err := getWinOrEmpty(c.Request.Context(), userId, date)
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	// make sure the client is not overwriting the entry modified from another device
+	if !checkWinVersion(c, win) {
+		return
+	}
+
+	if !change(win) {
+		toNotFound(c)
+		return
+	}
+	if overallResult != nil {
+		win.OverallResult = *overallResult
+	}
+	updated := deriveWinFromEntries(*win, generateTimestamp())
+
+	// sanitize
+	if err := validateWin(date, updated); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
+	// the win may have changed since it was read
+	err = dataStore.updateWin(c.Request.Context(), userId, date, updated, getIfMatchVersion(c))
+	if err == errConflict {
+		toWinVersionConflict(c, userId, date)
+		return
+	}
+	if err != nil {
+		toStorageError(c, err)
+		return
+	}
+
+	toWinSuccess(c, status, updated)
+}
+
+func applyWinEntryUpdate(entry *winEntryData, update winEntryUpdateData) {
+	if update.Text != nil {
+		entry.Text = *update.Text
+	}
+	if update.Priorities != nil {
+		entry.Priorities = *update.Priorities
+	}
+}
+
+// Only applies to the wins sent with entries, the wins sent by the clients that do not know about entries are kept as they are
+func prepareWinEntries(win winData, createdAt string) winData {
+	if len(win.Entries) == 0 {
+		return win
+	}
+
+	return deriveWinFromEntries(win, createdAt)
+}
+
+// Entries without ids are the new ones, text and priorities of the day are derived from the entries
+func deriveWinFromEntries(win winData, createdAt string) winData {
+	prepared := copyWin(win)
+	priorities := []string{}
+	isPriorityAdded := map[string]bool{}
+	texts := []string{}
+	for i := range prepared.Entries {
+		entry := &prepared.Entries[i]
+		if entry.Id == "" {
+			// ids are random, so the chance of the failure here is neglectable
+			entry.Id, _ = generateWinEntryId()
+			entry.CreatedAt = createdAt
+		}
+		if entry.Priorities == nil {
+			entry.Priorities = []string{}
+		}
+
+		if entry.Text != "" {
+			texts = append(texts, entry.Text)
+		}
+		for _, p := range entry.Priorities {
+			if !isPriorityAdded[p] {
+				isPriorityAdded[p] = true
+				priorities = append(priorities, p)
+			}
+		}
+	}
+	prepared.Text = strings.Join(texts, "\n")
+	prepared.Priorities = priorities
+
+	return prepared
+}
+
+// Migrates the win saved before entries were introduced, on the fly
+func getWinEntries(win winData) []winEntryData {
+	if len(win.Entries) > 0 {
+		return win.Entries
+	}
+	if win.Text == "" && len(win.Priorities) == 0 {
+		return []winEntryData{}
+	}
+
+	return []winEntryData{{
+		Id:         WIN_LEGACY_ENTRY_ID,
+		Text:       win.Text,
+		Priorities: win.Priorities,
+	}}
+}
+
+func validateWinEntries(entries []winEntryData) error {
+	if len(entries) > WIN_ENTRIES_MAX_SIZE {
+		return fmt.Errorf("too many entries, max %d allowed", WIN_ENTRIES_MAX_SIZE)
+	}
+
+	ids := map[string]bool{}
+	for _, entry := range entries {
+		if ids[entry.Id] {
+			return fmt.Errorf("duplicate entry id '%s'", entry.Id)
+		}
+		ids[entry.Id] = true
+
+		if !isWinTextValid(entry.Text) {
+			return fmt.Errorf("invalid value '%s' for 'text', should be less than %d characters long",
+				entry.Text,
+				WIN_TEXT_MAX_LENGTH)
+		}
+		if !isWinPriorityListValid(entry.Priorities) {
+			return fmt.Errorf("invalid value '%s' for 'priorities', max %d items allowed, non-empty and less than %d characters long",
+				entry.Text,
+				WIN_PRIORITIES_MAX_SIZE,
+				PRIORITY_ID_MAX_LENGTH)
+		}
+	}
+
+	return nil
+}
+
+func generateWinEntryId() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
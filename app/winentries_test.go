@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func callWinHandler(handler func(c *gin.Context, userId string, email string), method string, params gin.Params, body string) (int, winData) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/win", strings.NewReader(body))
+	c.Params = params
+
+	handler(c, "user", "user@example.com")
+
+	var response struct {
+		Data winData `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.Data
+}
+
+func TestLegacyWinIsPresentedAsSingleEntry(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	dataStore.updateWin(context.Background(), "user", "20211001", winData{Text: "Rested", OverallResult: 2, Priorities: []string{"001"}}, "")
+
+	win, _ := getWinOrEmpty(context.Background(), "user", "20211001")
+
+	assert.Equal(t, []winEntryData{{Id: WIN_LEGACY_ENTRY_ID, Text: "Rested", Priorities: []string{"001"}}}, win.Entries)
+}
+
+func TestAddWinEntries(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	dataStore.updateWin(context.Background(), "user", "20211001", winData{Text: "Rested", Priorities: []string{"001"}}, "")
+	params := gin.Params{{Key: "dt", Value: "20211001"}}
+
+	code, win := callWinHandler(handlePostWinEntry, "POST", params, `{"text": "Ran", "priorities": ["002", "001"]}`)
+
+	assert.Equal(t, 201, code)
+	assert.Equal(t, 2, len(win.Entries))
+	assert.Equal(t, WIN_LEGACY_ENTRY_ID, win.Entries[0].Id)
+	assert.NotEqual(t, "", win.Entries[1].CreatedAt)
+	assert.Equal(t, "Rested\nRan", win.Text)
+	assert.Equal(t, []string{"001", "002"}, win.Priorities)
+	assert.Equal(t, OVERALL_DAY_RESULT_GOT_MY_WIN, win.OverallResult)
+
+	stored, _ := dataStore.getWin(context.Background(), "user", "20211001")
+	assert.Equal(t, 2, len(stored.Entries))
+	assert.Equal(t, "Rested\nRan", stored.Text)
+}
+
+func TestPatchAndDeleteWinEntry(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	params := gin.Params{{Key: "dt", Value: "20211001"}}
+	_, win := callWinHandler(handlePostWinEntry, "POST", params, `{"text": "Ran"}`)
+	_, win = callWinHandler(handlePostWinEntry, "POST", params, `{"text": "Read", "overall": 4}`)
+	assert.Equal(t, OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT, win.OverallResult)
+	entryParams := gin.Params{{Key: "dt", Value: "20211001"}, {Key: "id", Value: win.Entries[0].Id}}
+
+	code, win := callWinHandler(handlePatchWinEntry, "PATCH", entryParams, `{"text": "Ran 10k"}`)
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "Ran 10k\nRead", win.Text)
+
+	code, win = callWinHandler(handleDeleteWinEntry, "DELETE", entryParams, "")
+
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 1, len(win.Entries))
+	assert.Equal(t, "Read", win.Text)
+
+	code, _ = callWinHandler(handleDeleteWinEntry, "DELETE", entryParams, "")
+
+	assert.Equal(t, 404, code)
+}
+
+func TestWinEntryUpdateIsValidated(t *testing.T) {
+	dataStore = NewInMemoryStore()
+	params := gin.Params{{Key: "dt", Value: "20211001"}}
+
+	code, _ := callWinHandler(handlePostWinEntry, "POST", params, `{"text": "Ran", "priorities": [""]}`)
+
+	assert.Equal(t, 400, code)
+}
+
+func TestWinEntriesAreValidatedTogether(t *testing.T) {
+	longText := []winEntryData{}
+	manyPriorities := []winEntryData{}
+	for i := 0; i < 2; i++ {
+		longText = append(longText, winEntryData{Text: strings.Repeat("a", WIN_TEXT_MAX_LENGTH)})
+		priorities := []string{}
+		for j := 0; j < WIN_PRIORITIES_MAX_SIZE; j++ {
+			priorities = append(priorities, fmt.Sprintf("%d-%d", i, j))
+		}
+		manyPriorities = append(manyPriorities, winEntryData{Priorities: priorities})
+	}
+
+	assert.NotNil(t, validateWin("20211001", deriveWinFromEntries(winData{Entries: longText}, "")))
+	assert.NotNil(t, validateWin("20211001", deriveWinFromEntries(winData{Entries: manyPriorities}, "")))
+	assert.Nil(t, validateWin("20211001", deriveWinFromEntries(winData{Entries: longText[:1]}, "")))
+}
@@ -2,10 +2,18 @@ package app
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	WIN_STATS_GROUP_BY_DAY   = "day"
+	WIN_STATS_GROUP_BY_WEEK  = "week"
+	WIN_STATS_GROUP_BY_MONTH = "month"
+)
+
 type winListShortData struct {
 	Items []winOnDayShortData `json:"items"`
 }
@@ -18,6 +26,37 @@ type winOnDayShortData struct {
 type winShortData struct {
 	OverallResult int      `json:"overall"`
 	Priorities    []string `json:"priorities"`
+	Tags          []string `json:"tags"`
+}
+
+type winStatsOptionsData struct {
+	GroupBy string `form:"groupBy"`
+}
+
+type winStatsAggregatedData struct {
+	GroupBy   string                            `json:"groupBy"`
+	Total     *winStatsAggregateData            `json:"total"`
+	ByWeekday map[string]*winStatsAggregateData `json:"byWeekday"`
+	ByMonth   map[string]*winStatsAggregateData `json:"byMonth"`
+	Buckets   []*winStatsBucketData             `json:"buckets"`
+}
+
+type winStatsBucketData struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	*winStatsAggregateData
+}
+
+// Days are the days with the entry, even when no win was recorded
+type winStatsAggregateData struct {
+	Days          int                `json:"days"`
+	WinDays       int                `json:"winDays"`
+	ByOverall     map[string]int     `json:"byOverall"`
+	ByPriority    map[string]int     `json:"byPriority"`
+	PriorityShare map[string]float64 `json:"priorityShare"`
+	ByTag         map[string]int     `json:"byTag"`
+
+	winDaysByPriority map[string]int
 }
 
 func handleGetWinStats(c *gin.Context, userId string, email string) {
@@ -28,6 +67,13 @@ func handleGetWinStats(c *gin.Context, userId string, email string) {
 		return
 	}
 
+	// get aggregation from the query string, raw per-day rows when not provided
+	var options winStatsOptionsData
+	if err := c.ShouldBindQuery(&options); err != nil {
+		toBadRequest(c, err)
+		return
+	}
+
 	// sanitize
 	if !isDateValid(dateIntervalContainer.From) {
 		err := fmt.Errorf("invalid value '%s' for 'from'", dateIntervalContainer.From)
@@ -50,10 +96,27 @@ func handleGetWinStats(c *gin.Context, userId string, email string) {
 		toBadRequest(c, err)
 		return
 	}
+	if options.GroupBy != "" &&
+		options.GroupBy != WIN_STATS_GROUP_BY_DAY &&
+		options.GroupBy != WIN_STATS_GROUP_BY_WEEK &&
+		options.GroupBy != WIN_STATS_GROUP_BY_MONTH {
+		err := fmt.Errorf("invalid value '%s' for 'groupBy', should be '%s', '%s' or '%s'",
+			options.GroupBy,
+			WIN_STATS_GROUP_BY_DAY,
+			WIN_STATS_GROUP_BY_WEEK,
+			WIN_STATS_GROUP_BY_MONTH)
+		toBadRequest(c, err)
+		return
+	}
 
-	winDays, err := getWinDayStats(userId, dateIntervalContainer.From, dateIntervalContainer.To)
+	winDays, err := dataStore.getWinDayStats(c.Request.Context(), userId, dateIntervalContainer.From, dateIntervalContainer.To)
 	if err != nil {
-		toInternalServerError(c, err.Error())
+		toStorageError(c, err)
+		return
+	}
+
+	if options.GroupBy != "" {
+		toSuccessWithETag(c, aggregateWinStats(winDays, dateIntervalContainer.From, dateIntervalContainer.To, options.GroupBy))
 		return
 	}
 
@@ -66,5 +129,130 @@ func handleGetWinStats(c *gin.Context, userId string, email string) {
 	/*toBadRequest(c, fmt.Errorf("Something went wrong returning stats"))
 	return*/
 
-	toSuccess(c, winDayList)
+	toSuccessWithETag(c, winDayList)
+}
+
+// Buckets cover the whole interval, including the days with no entries, so they can be charted as they are
+// Weeks start on Monday, the first and the last bucket are cut by the interval
+func aggregateWinStats(winDays []winOnDayShortData, from string, to string, groupBy string) winStatsAggregatedData {
+	result := winStatsAggregatedData{
+		GroupBy:   groupBy,
+		Total:     newWinStatsAggregate(),
+		ByWeekday: map[string]*winStatsAggregateData{},
+		ByMonth:   map[string]*winStatsAggregateData{},
+		Buckets:   []*winStatsBucketData{},
+	}
+
+	start, err := time.Parse("20060102", from)
+	if err != nil {
+		return result
+	}
+	end, err := time.Parse("20060102", to)
+	if err != nil {
+		return result
+	}
+
+	// prepare buckets
+	bucketByDate := map[string]*winStatsBucketData{}
+	var bucket *winStatsBucketData
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		date := d.Format("20060102")
+		if bucket == nil || isBucketStart(d, groupBy) {
+			bucket = &winStatsBucketData{
+				Start:                 date,
+				winStatsAggregateData: newWinStatsAggregate(),
+			}
+			result.Buckets = append(result.Buckets, bucket)
+		}
+		bucket.End = date
+		bucketByDate[date] = bucket
+	}
+
+	// count
+	for _, winDay := range winDays {
+		d, err := time.Parse("20060102", winDay.Date)
+		if err != nil {
+			continue
+		}
+
+		weekday := d.Weekday().String()
+		if _, ok := result.ByWeekday[weekday]; !ok {
+			result.ByWeekday[weekday] = newWinStatsAggregate()
+		}
+		month := d.Format("200601")
+		if _, ok := result.ByMonth[month]; !ok {
+			result.ByMonth[month] = newWinStatsAggregate()
+		}
+
+		result.Total.add(winDay.Win)
+		result.ByWeekday[weekday].add(winDay.Win)
+		result.ByMonth[month].add(winDay.Win)
+		if bucket, ok := bucketByDate[winDay.Date]; ok {
+			bucket.add(winDay.Win)
+		}
+	}
+
+	// shares can only be calculated when everything is counted
+	result.Total.calculatePriorityShare()
+	for _, aggregate := range result.ByWeekday {
+		aggregate.calculatePriorityShare()
+	}
+	for _, aggregate := range result.ByMonth {
+		aggregate.calculatePriorityShare()
+	}
+	for _, bucket := range result.Buckets {
+		bucket.calculatePriorityShare()
+	}
+
+	return result
+}
+
+func isBucketStart(d time.Time, groupBy string) bool {
+	switch groupBy {
+	case WIN_STATS_GROUP_BY_WEEK:
+		return d.Weekday() == time.Monday
+	case WIN_STATS_GROUP_BY_MONTH:
+		return d.Day() == 1
+	default:
+		return true
+	}
+}
+
+func newWinStatsAggregate() *winStatsAggregateData {
+	return &winStatsAggregateData{
+		ByOverall:     map[string]int{},
+		ByPriority:    map[string]int{},
+		PriorityShare: map[string]float64{},
+		ByTag:         map[string]int{},
+
+		winDaysByPriority: map[string]int{},
+	}
+}
+
+func (a *winStatsAggregateData) add(win winShortData) {
+	a.Days++
+	a.ByOverall[strconv.Itoa(win.OverallResult)]++
+	for _, p := range win.Priorities {
+		a.ByPriority[p]++
+	}
+	for _, tag := range win.Tags {
+		a.ByTag[tag]++
+	}
+
+	if isWinDay(win.OverallResult) {
+		a.WinDays++
+		for _, p := range win.Priorities {
+			a.winDaysByPriority[p]++
+		}
+	}
+}
+
+// The share of win days the priority was worked on
+func (a *winStatsAggregateData) calculatePriorityShare() {
+	if a.WinDays == 0 {
+		return
+	}
+	for p, count := range a.winDaysByPriority {
+		a.PriorityShare[p] = float64(count) / float64(a.WinDays)
+	}
 }
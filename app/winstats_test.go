@@ -0,0 +1,76 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getWinStatsTestData() []winOnDayShortData {
+	return []winOnDayShortData{
+		{Date: "20211029", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN, Priorities: []string{"001"}, Tags: []string{"work"}}},
+		{Date: "20211030", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_COULD_NOT_GET_MY_WIN, Priorities: []string{"001", "002"}}},
+		{Date: "20211101", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_AWESOME_ACHIEVEMENT, Priorities: []string{"002"}}},
+		{Date: "20211108", Win: winShortData{OverallResult: OVERALL_DAY_RESULT_GOT_MY_WIN, Priorities: []string{"001"}}},
+	}
+}
+
+func TestAggregateWinStatsTotal(t *testing.T) {
+	stats := aggregateWinStats(getWinStatsTestData(), "20211028", "20211110", WIN_STATS_GROUP_BY_DAY)
+
+	assert.Equal(t, 4, stats.Total.Days)
+	assert.Equal(t, 3, stats.Total.WinDays)
+	assert.Equal(t, map[string]int{"1": 2, "2": 1, "4": 1}, stats.Total.ByOverall)
+	assert.Equal(t, map[string]int{"001": 3, "002": 2}, stats.Total.ByPriority)
+	assert.InDelta(t, 2.0/3.0, stats.Total.PriorityShare["001"], 0.0001)
+	assert.InDelta(t, 1.0/3.0, stats.Total.PriorityShare["002"], 0.0001)
+	assert.Equal(t, map[string]int{"work": 1}, stats.Total.ByTag)
+	assert.Equal(t, 2, stats.ByWeekday["Monday"].Days)
+	assert.Equal(t, 2, stats.ByMonth["202110"].Days)
+	assert.Equal(t, 2, stats.ByMonth["202111"].Days)
+}
+
+func TestAggregateWinStatsByDay(t *testing.T) {
+	stats := aggregateWinStats(getWinStatsTestData(), "20211028", "20211110", WIN_STATS_GROUP_BY_DAY)
+
+	assert.Equal(t, 14, len(stats.Buckets))
+	assert.Equal(t, "20211028", stats.Buckets[0].Start)
+	assert.Equal(t, 0, stats.Buckets[0].Days)
+	assert.Equal(t, "20211029", stats.Buckets[1].End)
+	assert.Equal(t, 1, stats.Buckets[1].WinDays)
+}
+
+func TestAggregateWinStatsByWeek(t *testing.T) {
+	stats := aggregateWinStats(getWinStatsTestData(), "20211028", "20211110", WIN_STATS_GROUP_BY_WEEK)
+
+	assert.Equal(t, 3, len(stats.Buckets))
+	assert.Equal(t, "20211028", stats.Buckets[0].Start)
+	assert.Equal(t, "20211031", stats.Buckets[0].End)
+	assert.Equal(t, 2, stats.Buckets[0].Days)
+	assert.Equal(t, "20211101", stats.Buckets[1].Start)
+	assert.Equal(t, "20211107", stats.Buckets[1].End)
+	assert.Equal(t, 1, stats.Buckets[1].Days)
+	assert.Equal(t, "20211110", stats.Buckets[2].End)
+}
+
+func TestAggregateWinStatsByMonth(t *testing.T) {
+	stats := aggregateWinStats(getWinStatsTestData(), "20211028", "20211110", WIN_STATS_GROUP_BY_MONTH)
+
+	assert.Equal(t, 2, len(stats.Buckets))
+	assert.Equal(t, "20211031", stats.Buckets[0].End)
+	assert.Equal(t, 1, stats.Buckets[0].WinDays)
+	assert.Equal(t, "20211101", stats.Buckets[1].Start)
+	assert.Equal(t, 2, stats.Buckets[1].WinDays)
+}
+
+func TestAggregateWinStatsBucketJson(t *testing.T) {
+	stats := aggregateWinStats(getWinStatsTestData(), "20211029", "20211029", WIN_STATS_GROUP_BY_DAY)
+
+	bucketJson, _ := json.Marshal(stats.Buckets[0])
+
+	assert.Equal(t,
+		"{\"start\":\"20211029\",\"end\":\"20211029\",\"days\":1,\"winDays\":1,"+
+			"\"byOverall\":{\"1\":1},\"byPriority\":{\"001\":1},\"priorityShare\":{\"001\":1},\"byTag\":{\"work\":1}}",
+		string(bucketJson))
+}
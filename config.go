@@ -3,6 +3,8 @@ package main
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
@@ -32,6 +34,70 @@ func GetMandatoryString(key string) string {
 	return val
 }
 
+func GetOptionalInt(key string, def int) int {
+	text := os.Getenv(key)
+	if text == "" {
+		log.Printf("Could not find the value for the key '%s'. Using default value '%d'", key, def)
+		return def
+	}
+
+	val, err := strconv.Atoi(text)
+	if err != nil {
+		log.Fatalf("Could not parse value '%s' as integer", text)
+	}
+
+	return val
+}
+
+func GetOptionalDuration(key string, def time.Duration) time.Duration {
+	text := os.Getenv(key)
+	if text == "" {
+		log.Printf("Could not find the value for the key '%s'. Using default value '%v'", key, def)
+		return def
+	}
+
+	val, err := time.ParseDuration(text)
+	if err != nil {
+		log.Fatalf("Could not parse value '%s' as duration", text)
+	}
+
+	return val
+}
+
+func GetOptionalFloat(key string, def float64) float64 {
+	text := os.Getenv(key)
+	if text == "" {
+		log.Printf("Could not find the value for the key '%s'. Using default value '%v'", key, def)
+		return def
+	}
+
+	val, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		log.Fatalf("Could not parse value '%s' as float", text)
+	}
+
+	return val
+}
+
+// Comma-separated values, empty when not set
+func GetOptionalList(key string) []string {
+	text := os.Getenv(key)
+	if text == "" {
+		log.Printf("Could not find the value for the key '%s'. Using empty list", key)
+		return []string{}
+	}
+
+	list := []string{}
+	for _, val := range strings.Split(text, ",") {
+		val = strings.TrimSpace(val)
+		if val != "" {
+			list = append(list, val)
+		}
+	}
+
+	return list
+}
+
 func GetBoolean(key string) bool {
 	text := os.Getenv(key)
 	if text == "" {
@@ -45,3 +111,15 @@ func GetBoolean(key string) bool {
 
 	return val
 }
+
+// Returns the storage backend to use: "dynamodb", "sqlite" or "memory"
+func GetStorage() string {
+	storage := GetOptionalString("WINADAY_STORAGE", "dynamodb")
+	switch storage {
+	case "dynamodb", "sqlite", "memory":
+		return storage
+	}
+
+	log.Fatalf("Unknown storage '%s', expected one of: dynamodb, sqlite, memory", storage)
+	return ""
+}
@@ -8,6 +8,7 @@ import (
 
 var isAlive = true
 var isReady = false
+var readinessCheck = func() bool { return true }
 
 func HandleHealthCheck(c *gin.Context) {
 	c.Status(http.StatusOK)
@@ -22,7 +23,7 @@ func HandleLivenessCheck(c *gin.Context) {
 }
 
 func HandleReadinessCheck(c *gin.Context) {
-	if isReady {
+	if isReady && readinessCheck() {
 		c.Status(http.StatusOK)
 	} else {
 		c.Status(http.StatusServiceUnavailable)
@@ -33,6 +34,11 @@ func SetIsReadyGlobally() {
 	isReady = true
 }
 
+// The check is made on every readiness probe, so the instance can become not ready and ready again
+func SetReadinessCheck(check func() bool) {
+	readinessCheck = check
+}
+
 func SetLivenessGlobally(val bool) {
 	isAlive = val
 }
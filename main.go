@@ -30,10 +30,88 @@ func main() {
 	// initialize REST stats
 	reststats.Initialize(version)
 
+	// initialize storage
+	app.SetStorageTimeout(GetOptionalDuration("WINADAY_STORAGE_TIMEOUT", 5*time.Second))
+	app.SetStorageRetryPolicy(
+		GetOptionalInt("WINADAY_STORAGE_RETRY_ATTEMPTS", 3),
+		GetOptionalDuration("WINADAY_STORAGE_RETRY_BASE_DELAY", 50*time.Millisecond),
+		GetOptionalFloat("WINADAY_STORAGE_RETRY_JITTER", 0.5))
+
+	// fail fast after that many storage failures in a row, until the cooldown is over, 0 disables the circuit breaker
+	app.SetStorageCircuitBreaker(
+		GetOptionalInt("WINADAY_STORAGE_BREAKER_THRESHOLD", 5),
+		GetOptionalDuration("WINADAY_STORAGE_BREAKER_COOLDOWN", 30*time.Second))
+	var store app.Store
+	switch GetStorage() {
+	case "dynamodb":
+		region := GetOptionalString("WINADAY_AWS_REGION", "")
+		endpoint := GetOptionalString("WINADAY_DYNAMODB_ENDPOINT", "")
+		tableName := GetOptionalString("WINADAY_DYNAMODB_TABLE", "winaday")
+		dynamoDbStore, err := app.NewDynamoDbStore(region, endpoint, tableName)
+		if err != nil {
+			log.Fatalf("Could not load AWS config: %v", err)
+		}
+		store = dynamoDbStore
+	case "sqlite":
+		sqlitePath := GetOptionalString("WINADAY_SQLITE_PATH", "winaday.db")
+		sqliteStore, err := app.NewSqliteStore(sqlitePath)
+		if err != nil {
+			log.Fatalf("Could not open SQLite database '%s': %v", sqlitePath, err)
+		}
+		store = sqliteStore
+	case "memory":
+		store = app.NewInMemoryStore()
+	}
+
+	// cache responses, 0 disables the cache
+	cacheSize := GetOptionalInt("WINADAY_CACHE_SIZE", 1000)
+	cacheTtl := GetOptionalDuration("WINADAY_CACHE_TTL", time.Minute)
+	if cacheSize > 0 {
+		store = app.NewCachingStore(store, cacheSize, cacheTtl)
+	}
+
+	// keep that many previous versions of every win for that long, 0 versions disables the history, 0 age keeps them forever
+	app.SetWinHistoryRetention(
+		GetOptionalInt("WINADAY_WIN_HISTORY_SIZE", 10),
+		GetOptionalDuration("WINADAY_WIN_HISTORY_TTL", 30*24*time.Hour))
+
+	// data is deleted after the grace period, so the deletion can be cancelled, 0 deletes right away
+	app.SetAccountDeletionGracePeriod(GetOptionalDuration("WINADAY_DELETION_GRACE_PERIOD", 7*24*time.Hour))
+
+	// keep the search index for that many users, the least recently searching users are evicted first
+	// the index is rebuilt after the TTL, so the updates made through the other instances are seen, keep it no longer than the cache TTL
+	app.SetSearchIndexMaxUsers(GetOptionalInt("WINADAY_SEARCH_INDEX_SIZE", 100))
+	app.SetSearchIndexTtl(GetOptionalDuration("WINADAY_SEARCH_INDEX_TTL", cacheTtl))
+
+	// clients are limited by IP, X-Forwarded-For is only used when the request comes through one of these proxies
+	trustedProxies := GetOptionalList("WINADAY_TRUSTED_PROXIES")
+	if err := app.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Could not parse trusted proxies: %v", err)
+	}
+
+	// configure rate limits, 0 requests per minute disables the limit
+	rateLimits := &app.RateLimitConfiguration{
+		SignIn: app.RateLimit{
+			RequestsPerMinute: GetOptionalInt("WINADAY_RATE_LIMIT_SIGNIN", 20),
+			Burst:             GetOptionalInt("WINADAY_RATE_LIMIT_SIGNIN_BURST", 5),
+		},
+		Public: app.RateLimit{
+			RequestsPerMinute: GetOptionalInt("WINADAY_RATE_LIMIT_PUBLIC", 120),
+			Burst:             GetOptionalInt("WINADAY_RATE_LIMIT_PUBLIC_BURST", 20),
+		},
+		User: app.RateLimit{
+			RequestsPerMinute: GetOptionalInt("WINADAY_RATE_LIMIT_USER", 600),
+			Burst:             GetOptionalInt("WINADAY_RATE_LIMIT_USER_BURST", 100),
+		},
+	}
+
 	// configure router
 	allowedOrigin := GetMandatoryString("WINADAY_ALLOW_ORIGIN")
 	router := gin.New()
-	app.SetupRouter(router, allowedOrigin)
+	app.SetupRouter(router, allowedOrigin, store, rateLimits)
+
+	// purge the accounts whose deletion grace period is over
+	app.StartAccountDeletionPurger(GetOptionalDuration("WINADAY_DELETION_PURGE_INTERVAL", time.Hour))
 
 	// determine whether to use HTTPS
 	useTls := GetBoolean("WINADAY_TLS")
@@ -13,17 +13,42 @@ var version string = ""
 var requestChannel chan<- int
 var endpointChannel chan<- string
 var responseStatsChannel chan<- *responseStatsData
+var cacheLookupChannel chan<- bool
+var storageRetryChannel chan<- string
+var storageCircuitOpenedChannel chan<- int
+var storageCircuitStateCheck = func() string { return "" }
 
 func Initialize(v string) {
 	version = v
 
-	requestChannel, endpointChannel, responseStatsChannel = startHandlingStats()
+	requestChannel, endpointChannel, responseStatsChannel, cacheLookupChannel, storageRetryChannel, storageCircuitOpenedChannel = startHandlingStats()
 }
 
 func CountRequestByEndpoint(endpoint string) {
 	endpointChannel <- endpoint
 }
 
+func CountCacheHit() {
+	cacheLookupChannel <- true
+}
+
+func CountCacheMiss() {
+	cacheLookupChannel <- false
+}
+
+func CountStorageRetry(operation string) {
+	storageRetryChannel <- operation
+}
+
+func CountStorageCircuitOpened() {
+	storageCircuitOpenedChannel <- 1
+}
+
+// The state is only known to the storage, so it is asked for every time the stats are requested
+func SetStorageCircuitStateCheck(check func() string) {
+	storageCircuitStateCheck = check
+}
+
 func HandleEndpointWithStats(handler gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -68,6 +93,16 @@ func UpdateResponseStatsOnRecover(start time.Time, url string, statusCode int) {
 	responseStatsChannel <- responseStats
 }
 
+func UpdateResponseStatsOnThrottle(start time.Time, url string) {
+	responseStats := &responseStatsData{
+		time:       start,
+		url:        url,
+		statusCode: http.StatusTooManyRequests,
+		duration:   0,
+	}
+	responseStatsChannel <- responseStats
+}
+
 func RequestCounter() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		requestChannel <- 1
@@ -87,6 +122,15 @@ type statsResult struct {
 	RequestsLast10                      []*requestStatsData   `json:"requests_last_10"`
 	FailedRequestsLast10                []*requestStatsData   `json:"failed_requests_last_10"`
 	SlowRequestsLast10                  []*requestStatsData   `json:"slow_requests_last_10"`
+	CacheHits                           int                   `json:"cache_hits"`
+	CacheMisses                         int                   `json:"cache_misses"`
+	StorageRetries                      map[string]int        `json:"storage_retries"`
+	StorageCircuit                      *storageCircuitData   `json:"storage_circuit"`
+}
+
+type storageCircuitData struct {
+	State  string `json:"state"`
+	Opened int    `json:"opened"`
 }
 
 type requestStatsData struct {
@@ -124,6 +168,13 @@ func HandleGetStats(c *gin.Context) {
 		RequestsLast10:                      requestsLast10,
 		FailedRequestsLast10:                failedRequestsLast10,
 		SlowRequestsLast10:                  slowRequestsLast10,
+		CacheHits:                           stats.cacheHits,
+		CacheMisses:                         stats.cacheMisses,
+		StorageRetries:                      stats.storageRetries,
+		StorageCircuit: &storageCircuitData{
+			State:  storageCircuitStateCheck(),
+			Opened: stats.storageCircuitOpened,
+		},
 	}
 
 	c.JSON(http.StatusOK, result)
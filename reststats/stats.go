@@ -19,6 +19,10 @@ type statsData struct {
 	historyOfFailed          []*responseStatsData
 	historyOfSlow            []*responseStatsData
 	shortestSequenceDuration time.Duration
+	cacheHits                int
+	cacheMisses              int
+	storageRetries           map[string]int
+	storageCircuitOpened     int
 }
 
 type responseStatsData struct {
@@ -39,22 +43,32 @@ var stats = &statsData{
 	historyOfFailed:          make([]*responseStatsData, 0, CURIOSITY_FAILED),
 	historyOfSlow:            make([]*responseStatsData, 0, CURIOSITY_SLOW),
 	shortestSequenceDuration: -1,
+	cacheHits:                0,
+	cacheMisses:              0,
+	storageRetries:           map[string]int{},
+	storageCircuitOpened:     0,
 }
 
 func getStats() *statsData {
 	return stats
 }
 
-func startHandlingStats() (chan<- int, chan<- string, chan<- *responseStatsData) {
+func startHandlingStats() (chan<- int, chan<- string, chan<- *responseStatsData, chan<- bool, chan<- string, chan<- int) {
 	requests := make(chan int)
 	endpoints := make(chan string)
 	responseStats := make(chan *responseStatsData)
+	cacheLookups := make(chan bool)
+	storageRetries := make(chan string)
+	storageCircuitOpenings := make(chan int)
 
 	go countRequests(requests)
 	go countRequestsByEndpoint(endpoints)
 	go updateResponseStats(responseStats)
+	go countCacheLookups(cacheLookups)
+	go countStorageRetries(storageRetries)
+	go countStorageCircuitOpenings(storageCircuitOpenings)
 
-	return requests, endpoints, responseStats
+	return requests, endpoints, responseStats, cacheLookups, storageRetries, storageCircuitOpenings
 }
 
 func countRequests(ch <-chan int) {
@@ -77,6 +91,31 @@ func countRequestsByEndpoint(ch <-chan string) {
 	}
 }
 
+func countCacheLookups(ch <-chan bool) {
+	for {
+		isHit := <-ch
+		if isHit {
+			stats.cacheHits++
+		} else {
+			stats.cacheMisses++
+		}
+	}
+}
+
+func countStorageRetries(ch <-chan string) {
+	for {
+		operation := <-ch
+		stats.storageRetries[operation]++
+	}
+}
+
+func countStorageCircuitOpenings(ch <-chan int) {
+	for {
+		n := <-ch
+		stats.storageCircuitOpened += n
+	}
+}
+
 func updateResponseStats(ch <-chan *responseStatsData) {
 	for {
 		responseStats := <-ch
@@ -106,13 +145,17 @@ func getEmptyCountsByStatusCodeMap() map[string]int {
 		"2XX": 0,
 		"3XX": 0,
 		"4XX": 0,
+		"429": 0,
 		"5XX": 0,
 	}
 }
 
 func updateCountsByStatusCodeMap(responseMap map[string]int, statusCode int) {
+	// throttled requests are counted separately from other client errors
 	if statusCode >= 500 {
 		responseMap["5XX"]++
+	} else if statusCode == 429 {
+		responseMap["429"]++
 	} else if statusCode >= 400 {
 		responseMap["4XX"]++
 	} else if statusCode >= 300 {